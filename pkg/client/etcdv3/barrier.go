@@ -0,0 +1,108 @@
+package etcdv3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// ErrTooManyParticipants 進入 barrier 的人數超過設定的數量
+var ErrTooManyParticipants = errors.New("too many participants entered the barrier")
+
+// DoubleBarrier 雙重屏障，Enter 等到 count 個參與者都進入後才放行，
+// Leave 等到所有參與者都離開後才放行，用於批次作業的分段同步，
+// 參與者的 key 綁定 session 的 lease，程式掛掉時會自動離開
+type DoubleBarrier struct {
+	s     *concurrency.Session
+	key   string
+	count int
+	myKey string
+}
+
+// NewDoubleBarrier ...
+func (client *Client) NewDoubleBarrier(key string, count int, opts ...concurrency.SessionOption) (barrier *DoubleBarrier, err error) {
+	barrier = &DoubleBarrier{key: key, count: count}
+	barrier.s, err = concurrency.NewSession(client.Client, opts...)
+	if err != nil {
+		return nil, err
+	}
+	barrier.myKey = fmt.Sprintf("%s/waiters/%x", key, barrier.s.Lease())
+	return
+}
+
+// Enter 等待 count 個參與者進入
+func (barrier *DoubleBarrier) Enter(ctx context.Context) error {
+	client := barrier.s.Client()
+	put, err := client.Put(ctx, barrier.myKey, "", clientv3.WithLease(barrier.s.Lease()))
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Get(ctx, barrier.key+"/waiters", clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return err
+	}
+	if int(resp.Count) > barrier.count {
+		_, _ = client.Delete(ctx, barrier.myKey)
+		return ErrTooManyParticipants
+	}
+	if int(resp.Count) == barrier.count {
+		// 最後一個進入的人通知其他人
+		_, err = client.Put(ctx, barrier.key+"/ready", "", clientv3.WithLease(barrier.s.Lease()))
+		return err
+	}
+	return waitEvent(ctx, client, barrier.key+"/ready", put.Header.Revision, mvccpb.PUT)
+}
+
+// Leave 等待所有參與者離開
+func (barrier *DoubleBarrier) Leave(ctx context.Context) error {
+	client := barrier.s.Client()
+	for {
+		resp, err := client.Get(ctx, barrier.key+"/waiters", clientv3.WithPrefix())
+		if err != nil {
+			return err
+		}
+		if len(resp.Kvs) == 0 {
+			return nil
+		}
+
+		lowest, highest := resp.Kvs[0], resp.Kvs[0]
+		for _, kv := range resp.Kvs {
+			if kv.ModRevision < lowest.ModRevision {
+				lowest = kv
+			}
+			if kv.ModRevision > highest.ModRevision {
+				highest = kv
+			}
+		}
+
+		// 只剩自己，清掉 ready 讓 barrier 可以再次使用
+		if len(resp.Kvs) == 1 && string(resp.Kvs[0].Key) == barrier.myKey {
+			_, err = client.Txn(ctx).Then(
+				clientv3.OpDelete(barrier.key+"/ready"),
+				clientv3.OpDelete(barrier.myKey),
+			).Commit()
+			return err
+		}
+
+		// 最早進入的人最後離開，等待最晚進入的人；其他人先刪除自己再等待最早的人
+		wait := lowest
+		if string(lowest.Key) == barrier.myKey {
+			wait = highest
+		} else if _, err = client.Delete(ctx, barrier.myKey); err != nil {
+			return err
+		}
+		if err = waitEvent(ctx, client, string(wait.Key), resp.Header.Revision+1, mvccpb.DELETE); err != nil {
+			return err
+		}
+	}
+}
+
+// Close 關閉 session，尚未離開的 key 會一併被移除
+func (barrier *DoubleBarrier) Close() error {
+	return barrier.s.Close()
+}
@@ -2,47 +2,81 @@ package etcdv3
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
+	"errors"
 	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/clientv3/concurrency"
 	"github.com/coreos/etcd/mvcc/mvccpb"
 	"github.com/digital-monster-1997/digicore/pkg/dlog"
+	"github.com/digital-monster-1997/digicore/pkg/ecode"
 	grpcprom "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"google.golang.org/grpc"
-	"io/ioutil"
 	"strings"
 	"time"
 )
 
+var (
+	// ErrEndpointsEmpty 沒有設定任何 etcd endpoint
+	ErrEndpointsEmpty = errors.New("client etcd endpoints empty")
+)
+
 type Client struct {
 	*clientv3.Client
 	config *Config
+	// health 定期健康檢查，沒有設定 HealthCheckInterval 時為 nil
+	health *healthMonitor
+	// reloader 監看 client 憑證，沒有設定 CerFile 時為 nil
+	reloader *certReloader
+}
+
+// Logger 返回 client 使用的 logger，子套件以它為基礎加上自己的 mod
+func (client *Client) Logger() *dlog.Logger {
+	return client.config.logger
 }
 
-// 設定一個新的 etcd client
+// 設定一個新的 etcd client，任何錯誤都會 panic
 func newClient(config *Config)*Client{
+	client, err := newClientE(context.Background(), config)
+	if err != nil {
+		config.logger.Panic("client etcd start panic", dlog.FieldErrKind(ecode.ErrKindAny), dlog.FieldErr(err), dlog.FieldValueAny(config))
+	}
+	return client
+}
+
+// 設定一個新的 etcd client，錯誤會返回給呼叫者
+func newClientE(ctx context.Context, config *Config) (*Client, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	conf := clientv3.Config{
 		Endpoints: config.Endpoints,
 		DialTimeout: config.ConnectTimeout,
 		DialKeepAliveTime: 10 *time.Second,
 		DialKeepAliveTimeout: 3 *time.Second,
 		DialOptions: []grpc.DialOption{
-			grpc.WithBlock(),
 			grpc.WithUnaryInterceptor(grpcprom.UnaryClientInterceptor),
 			grpc.WithStreamInterceptor(grpcprom.StreamClientInterceptor),
 		},
 		AutoSyncInterval: config.AutoSyncInterval,
 	}
+	// lazy 模式不等待連線建立，由 grpc 在背景重連
+	if !config.LazyConnect {
+		conf.DialOptions = append(conf.DialOptions, grpc.WithBlock())
+	}
+	// ctx 的期限比 ConnectTimeout 短時，以 ctx 為準
+	if deadline, ok := ctx.Deadline(); ok {
+		remain := time.Until(deadline)
+		// 期限已經過了，不能把負數交給 DialTimeout
+		if remain <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+		if conf.DialTimeout == 0 || remain < conf.DialTimeout {
+			conf.DialTimeout = remain
+		}
+	}
 	// 設定 logger
 	config.logger = config.logger.With(dlog.FieldAddrAny(config.Endpoints))
-	if config.Endpoints == nil {
-		//config.logger.Panic("client etcd endpoints empty", dlog.FieldMod(ecode.ModClientETCD), dlog.FieldValueAny(config))
-		config.logger.Panic("client etcd endpoints empty", dlog.FieldValueAny(config))
-	}
-
-	if !config.Secure {
-		conf.DialOptions = append(conf.DialOptions, grpc.WithInsecure())
+	if len(config.Endpoints) == 0 {
+		return nil, ErrEndpointsEmpty
 	}
 
 	if config.BasicAuth {
@@ -50,50 +84,75 @@ func newClient(config *Config)*Client{
 		conf.Password = config.Password
 	}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: false,
+	tlsConfig, reloader, err := config.buildTLSConfig()
+	if err != nil {
+		return nil, err
 	}
-	if config.CaCert != "" {
-		certBytes, err := ioutil.ReadFile(config.CaCert)
-		if err != nil {
-			config.logger.Panic("parse CaCert failed", dlog.Any("err", err))
-		}
-
-		caCertPool := x509.NewCertPool()
-		ok := caCertPool.AppendCertsFromPEM(certBytes)
-
-		if ok {
-			tlsConfig.RootCAs = caCertPool
-		}
-
+	if tlsConfig != nil {
+		conf.TLS = tlsConfig
+	} else {
+		conf.DialOptions = append(conf.DialOptions, grpc.WithInsecure())
 	}
 
-	if config.CaCert != "" && config.KeyFile != "" {
-		tlsCert, err := tls.LoadX509KeyPair(config.CerFile, config.KeyFile)
-		if err != nil {
-			config.logger.Panic("load CertFile or KeyFile failed", dlog.Any("config", config), dlog.Any("err", err))
+	client, err := dial(ctx, conf)
+	if err != nil {
+		if reloader != nil {
+			reloader.stop()
 		}
-		tlsConfig.Certificates = []tls.Certificate{tlsCert}
-
+		return nil, err
 	}
 
-	client, err := clientv3.New(conf)
-
-	if err != nil {
-		//config.logger.Panic("client etcd start panic", dlog.FieldMod(ecode.ModClientETCD), dlog.FieldErrKind(ecode.ErrKindAny), dlog.FieldErr(err), dlog.FieldValueAny(config))
-
-		config.logger.Panic("client etcd start panic", dlog.FieldErr(err), dlog.FieldValueAny(config))
+	cc := &Client{
+		Client:   client,
+		config:   config,
+		reloader: reloader,
+	}
+	if config.HealthCheckInterval > 0 {
+		cc.health = newHealthMonitor(cc, config.HealthCheckInterval)
 	}
 
-	cc := &Client{
-		Client: client,
-		config: config,
+	if config.LazyConnect {
+		config.logger.Info("dial etcd server lazily")
+	} else {
+		config.logger.Info("dial etcd server")
 	}
+	return cc, nil
+}
 
-	config.logger.Info("dial etcd server")
-	return cc
+// dial 建立 clientv3.Client，ctx 被取消時提前返回，稍後建好的連線會在背景關閉
+func dial(ctx context.Context, conf clientv3.Config) (*clientv3.Client, error) {
+	type result struct {
+		client *clientv3.Client
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		client, err := clientv3.New(conf)
+		done <- result{client: client, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.client, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.client != nil {
+				_ = r.client.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
 }
 
+// Close 停止健康檢查、憑證監看並關閉連線
+func (client *Client) Close() error {
+	if client.health != nil {
+		client.health.stop()
+	}
+	if client.reloader != nil {
+		client.reloader.stop()
+	}
+	return client.Client.Close()
+}
 
 // GetPrefix get prefix
 func (client *Client) GetPrefix(ctx context.Context, prefix string) (map[string]string, error) {
@@ -151,7 +210,7 @@ func (client *Client) GetValues(ctx context.Context, keys ...string) (map[string
 	var (
 		firstRevision = int64(0)
 		vars          = make(map[string]string)
-		maxTxnOps     = 128
+		maxTxnOps     = client.maxTxnOps()
 		getOps        = make([]string, 0, maxTxnOps)
 	)
 
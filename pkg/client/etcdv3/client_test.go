@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/digital-monster-1997/digicore/pkg/client/etcdv3/etcdtest"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
@@ -53,3 +54,73 @@ func Test_MutexLock(t *testing.T) {
 	err = etcdMutex.Lock(time.Second * 1)
 	assert.NotNil(t, err)
 }
+func TestBuildE_EmptyEndpoints(t *testing.T) {
+	config := DefaultConfig()
+	_, err := config.BuildE(context.Background())
+	assert.Equal(t, ErrEndpointsEmpty, err)
+}
+
+func TestBuildE_Unreachable(t *testing.T) {
+	config := DefaultConfig()
+	config.Endpoints = []string{etcdtest.FreeAddr(t)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := config.BuildE(ctx)
+	assert.NotNil(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+}
+
+func TestBuildE_ExpiredContext(t *testing.T) {
+	config := DefaultConfig()
+	config.Endpoints = []string{etcdtest.FreeAddr(t)}
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err := config.BuildE(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = config.BuildE(ctx)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestBuildE_LazyConnect(t *testing.T) {
+	config := DefaultConfig()
+	config.Endpoints = []string{etcdtest.FreeAddr(t)}
+	config.LazyConnect = true
+
+	etcdCli, err := config.BuildE(context.Background())
+	assert.Nil(t, err)
+	defer etcdCli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	statuses := etcdCli.Health(ctx)
+	assert.Len(t, statuses, 1)
+	assert.False(t, statuses[0].Healthy)
+	assert.NotNil(t, statuses[0].Err)
+}
+
+func TestHealth(t *testing.T) {
+	config := DefaultConfig()
+	config.Endpoints = []string{etcdtest.Start(t)}
+	config.HealthCheckInterval = 50 * time.Millisecond
+
+	etcdCli, err := config.BuildE(context.Background())
+	assert.Nil(t, err)
+	defer etcdCli.Close()
+
+	statuses := etcdCli.Health(context.Background())
+	assert.Len(t, statuses, 1)
+	assert.True(t, statuses[0].Healthy)
+	assert.NotZero(t, statuses[0].Leader)
+	assert.True(t, etcdCli.Healthy(context.Background()))
+
+	assert.Eventually(t, func() bool {
+		last := etcdCli.LastHealth()
+		return len(last) == 1 && last[0].Healthy
+	}, time.Second, 10*time.Millisecond)
+}
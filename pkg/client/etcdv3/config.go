@@ -1,25 +1,43 @@
 package etcdv3
 
 import (
+	"context"
 	"github.com/digital-monster-1997/digicore/pkg/config"
 	"github.com/digital-monster-1997/digicore/pkg/dlog"
+	"github.com/digital-monster-1997/digicore/pkg/ecode"
 	"time"
 )
 
 type Config struct {
 	Endpoints 			[]string  		`json:"endpoints"`
+	// CerFile、KeyFile client 憑證，用於 mTLS，檔案變動時會自動重新載入
 	CerFile 			string			`json:"cert_file"`
 	KeyFile 			string			`json:"key_file"`
+	// CaCert 驗證 server 憑證的 CA，沒有設定時使用系統的根憑證
 	CaCert 				string			`json:"ca_cert"`
+	// ServerName 驗證 server 憑證時使用的名稱，預設為 endpoint 的 host
+	ServerName 			string			`json:"server_name"`
+	// MinTLSVersion 最低的 TLS 版本，可以是 1.0、1.1、1.2、1.3，預設為 1.2
+	MinTLSVersion 		string			`json:"min_tls_version"`
+	// InsecureSkipVerify 不驗證 server 憑證，只應該在測試環境使用
+	InsecureSkipVerify 	bool			`json:"insecure_skip_verify"`
 	BasicAuth 			bool			`json:"basic_auth"`
 	UserName 			string			`json:"user_name"`
-	Password			string			`json:"password"`
+	// Password 標記為 secret，輸出日誌時會被遮蔽
+	Password			string			`json:"password" log:"secret"`
 	// ConnectTimeout 連線超時的時間
 	ConnectTimeout 		time.Duration	`json:"connect_timeout"`
+	// Secure 使用 TLS 連線，設定了任何憑證時也會啟用
 	Secure 				bool			`json:"secure"`
 	// AutoSyncInterval 自動同步 member list 的時間
 	AutoSyncInterval 	time.Duration	`json:"auto_sync_interval"`
 	TTL 				int				`json:"ttl"` // 單位： s
+	// MaxTxnOps 單一交易最多的操作數量，需與 server 的 --max-txn-ops 一致，批次操作會依此拆分
+	MaxTxnOps 			int				`json:"max_txn_ops"`
+	// LazyConnect 為真時 Build 不會阻塞等待連線建立，etcd 不可用時服務仍可先啟動
+	LazyConnect 		bool			`json:"lazy_connect"`
+	// HealthCheckInterval 定期檢查 endpoint 健康狀態的間隔，0 表示不啟用
+	HealthCheckInterval time.Duration	`json:"health_check_interval"`
 	logger 				*dlog.Logger
 }
 
@@ -29,18 +47,27 @@ func DefaultConfig() *Config {
 		BasicAuth:      false,
 		ConnectTimeout: 5 * time.Second,
 		Secure:         false,
-		logger:         dlog.DigitCore.With(dlog.FieldMod("client.etcd")),
+		MaxTxnOps:      DefaultMaxTxnOps,
+		logger:         dlog.DigitCore.With(dlog.FieldMod(ecode.ModClientETCD)),
 	}
 }
 
-// RawConfig  讀取 Config 當中的資料
+// RawConfig  讀取 Config 當中的資料，解析失敗會 panic
 func RawConfig(key string, cfg *config.Configuration) *Config {
+	config, err := RawConfigE(key, cfg)
+	if err != nil {
+		config.logger.Panic("client etcd parse config panic", dlog.FieldErrKind(ecode.ErrKindUnmarshalConfigErr), dlog.FieldErr(err), dlog.FieldKey(key), dlog.FieldValueAny(config))
+	}
+	return config
+}
+
+// RawConfigE 讀取 Config 當中的資料，解析失敗時返回錯誤而不是 panic
+func RawConfigE(key string, cfg *config.Configuration) (*Config, error) {
 	config := DefaultConfig()
 	if err := cfg.ReadToStruct(key, &config); err != nil {
-		config.logger.Panic("client etcd parse config panic", dlog.FieldErr(err), dlog.FieldKey(key), dlog.FieldValueAny(config))
-		//	config.logger.Panic("client etcd parse config panic",dlog.FieldErrKind(ecode.ErrKindUnmarshalConfigErr), dlog.FieldErr(err), dlog.FieldKey(key), dlog.FieldValueAny(config))
+		return config, err
 	}
-	return config
+	return config, nil
 }
 
 // WithLogger ...
@@ -49,8 +76,13 @@ func (config *Config) WithLogger(logger *dlog.Logger) *Config {
 	return config
 }
 
-// Build ...
+// Build 建立 client，任何錯誤都會 panic
 func (config *Config) Build() *Client {
 	client := newClient(config)
 	return client
 }
+
+// BuildE 建立 client，錯誤會返回給呼叫者，ctx 可用來限制連線等待的時間
+func (config *Config) BuildE(ctx context.Context) (*Client, error) {
+	return newClientE(ctx, config)
+}
@@ -0,0 +1,20 @@
+package etcdv3
+
+import (
+	"context"
+	"testing"
+
+	"github.com/digital-monster-1997/digicore/pkg/client/etcdv3/etcdtest"
+)
+
+// newTestClient 啟動 etcd 並返回連上它的 client
+func newTestClient(t *testing.T) *Client {
+	config := DefaultConfig()
+	config.Endpoints = []string{etcdtest.Start(t)}
+	etcdCli, err := config.BuildE(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = etcdCli.Close() })
+	return etcdCli
+}
@@ -0,0 +1,54 @@
+// Package etcdtest 在測試中啟動單節點的 embedded etcd
+package etcdtest
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+)
+
+// FreeAddr 取得一個目前沒有被使用的本機位址
+func FreeAddr(t testing.TB) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// Start 啟動一個單節點的 etcd，測試結束時關閉，回傳 client endpoint，
+// setup 可以在啟動前調整設定，例如設定 TLS
+func Start(t testing.TB, setup ...func(cfg *embed.Config)) string {
+	t.Helper()
+	clientURL, _ := url.Parse("http://" + FreeAddr(t))
+	peerURL, _ := url.Parse("http://" + FreeAddr(t))
+
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LCUrls = []url.URL{*clientURL}
+	cfg.ACUrls = []url.URL{*clientURL}
+	cfg.LPUrls = []url.URL{*peerURL}
+	cfg.APUrls = []url.URL{*peerURL}
+	for _, fn := range setup {
+		fn(cfg)
+	}
+	cfg.InitialCluster = fmt.Sprintf("%s=%s", cfg.Name, cfg.APUrls[0].String())
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd server not ready")
+	}
+	return cfg.ACUrls[0].Host
+}
@@ -0,0 +1,150 @@
+package etcdv3
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/digital-monster-1997/digicore/pkg/dlog"
+)
+
+// EndpointStatus 單一 endpoint 的健康狀態
+type EndpointStatus struct {
+	Endpoint string
+	Healthy  bool
+	// Latency 呼叫 Status 所花費的時間
+	Latency time.Duration
+	// Leader 該 endpoint 認定的 leader id，不健康時為 0
+	Leader uint64
+	// Revision 該 endpoint 目前的 revision
+	Revision  int64
+	Err       error
+	CheckedAt time.Time
+}
+
+// Health 併發檢查每一個 endpoint 的狀態，順序與 Endpoints() 相同
+func (client *Client) Health(ctx context.Context) []EndpointStatus {
+	endpoints := client.Endpoints()
+	statuses := make([]EndpointStatus, len(endpoints))
+
+	var wg sync.WaitGroup
+	wg.Add(len(endpoints))
+	for i, endpoint := range endpoints {
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			statuses[i] = client.endpointStatus(ctx, endpoint)
+		}(i, endpoint)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// Healthy 只要有一個 endpoint 健康就視為可用
+func (client *Client) Healthy(ctx context.Context) bool {
+	for _, status := range client.Health(ctx) {
+		if status.Healthy {
+			return true
+		}
+	}
+	return false
+}
+
+// LastHealth 返回健康檢查最近一次的結果，沒有啟用 HealthCheckInterval 時返回 nil
+func (client *Client) LastHealth() []EndpointStatus {
+	if client.health == nil {
+		return nil
+	}
+	return client.health.last()
+}
+
+func (client *Client) endpointStatus(ctx context.Context, endpoint string) EndpointStatus {
+	start := time.Now()
+	resp, err := client.Status(ctx, endpoint)
+	status := EndpointStatus{
+		Endpoint:  endpoint,
+		Latency:   time.Since(start),
+		Err:       err,
+		CheckedAt: start,
+	}
+	if err == nil {
+		status.Healthy = true
+		status.Leader = resp.Leader
+		status.Revision = resp.Header.GetRevision()
+	}
+	return status
+}
+
+// healthMonitor 定期檢查所有 endpoint，並在狀態改變時記錄 log
+type healthMonitor struct {
+	client   *Client
+	interval time.Duration
+	lock     sync.RWMutex
+	statuses []EndpointStatus
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newHealthMonitor(client *Client, interval time.Duration) *healthMonitor {
+	monitor := &healthMonitor{
+		client:   client,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	go monitor.run()
+	return monitor
+}
+
+func (monitor *healthMonitor) run() {
+	ticker := time.NewTicker(monitor.interval)
+	defer ticker.Stop()
+	for {
+		monitor.check()
+		select {
+		case <-ticker.C:
+		case <-monitor.done:
+			return
+		}
+	}
+}
+
+func (monitor *healthMonitor) check() {
+	// 單次檢查不超過一個週期，避免卡住下一輪
+	ctx, cancel := context.WithTimeout(context.Background(), monitor.interval)
+	defer cancel()
+	statuses := monitor.client.Health(ctx)
+
+	monitor.lock.Lock()
+	previous := make(map[string]bool, len(monitor.statuses))
+	for _, status := range monitor.statuses {
+		previous[status.Endpoint] = status.Healthy
+	}
+	monitor.statuses = statuses
+	monitor.lock.Unlock()
+
+	logger := monitor.client.config.logger
+	for _, status := range statuses {
+		healthy, ok := previous[status.Endpoint]
+		if ok && healthy == status.Healthy {
+			continue
+		}
+		if status.Healthy {
+			logger.Info("etcd endpoint healthy", dlog.FieldAddr(status.Endpoint), dlog.FieldCost(status.Latency))
+		} else {
+			logger.Warn("etcd endpoint unhealthy", dlog.FieldAddr(status.Endpoint), dlog.FieldCost(status.Latency), dlog.FieldErr(status.Err))
+		}
+	}
+}
+
+func (monitor *healthMonitor) last() []EndpointStatus {
+	monitor.lock.RLock()
+	defer monitor.lock.RUnlock()
+	statuses := make([]EndpointStatus, len(monitor.statuses))
+	copy(statuses, monitor.statuses)
+	return statuses
+}
+
+func (monitor *healthMonitor) stop() {
+	monitor.once.Do(func() {
+		close(monitor.done)
+	})
+}
@@ -0,0 +1,21 @@
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/digital-monster-1997/digicore/pkg/client/etcdv3"
+	"github.com/digital-monster-1997/digicore/pkg/client/etcdv3/etcdtest"
+)
+
+// newTestClient 啟動 etcd 並返回連上它的 client
+func newTestClient(t *testing.T) *etcdv3.Client {
+	config := etcdv3.DefaultConfig()
+	config.Endpoints = []string{etcdtest.Start(t)}
+	client, err := config.BuildE(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
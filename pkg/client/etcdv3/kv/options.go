@@ -0,0 +1,60 @@
+package kv
+
+import "time"
+
+type Option func(opts *Options)
+
+// 私有函數，載入所有選項
+func loadOptions(options ...Option) *Options {
+	opts := &Options{
+		Codec:      JSON,
+		MaxRetries: DefaultMaxRetries,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+type Options struct {
+	// Codec 編碼方式，預設為 JSON
+	Codec Codec
+	// TTL 每一筆寫入的資料預設的存活時間，0 表示永久保存
+	TTL time.Duration
+	// MaxRetries Update 發生版本衝突時最多重試幾次
+	MaxRetries int
+}
+
+// WithCodec ...
+func WithCodec(codec Codec) Option {
+	return func(opts *Options) {
+		opts.Codec = codec
+	}
+}
+
+// WithTTL ...
+func WithTTL(ttl time.Duration) Option {
+	return func(opts *Options) {
+		opts.TTL = ttl
+	}
+}
+
+// WithMaxRetries ...
+func WithMaxRetries(maxRetries int) Option {
+	return func(opts *Options) {
+		opts.MaxRetries = maxRetries
+	}
+}
+
+type PutOption func(opts *putOptions)
+
+type putOptions struct {
+	ttl time.Duration
+}
+
+// PutWithTTL 只對這一次寫入設定存活時間，覆蓋 Store 的 TTL
+func PutWithTTL(ttl time.Duration) PutOption {
+	return func(opts *putOptions) {
+		opts.ttl = ttl
+	}
+}
@@ -0,0 +1,309 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/digital-monster-1997/digicore/pkg/client/etcdv3"
+	"github.com/digital-monster-1997/digicore/pkg/dlog"
+)
+
+// DefaultMaxRetries Update 預設的最大重試次數
+const DefaultMaxRetries = 10
+
+var (
+	// ErrNotFound key 不存在
+	ErrNotFound = errors.New("kv: key not found")
+	// ErrConflict Update 重試次數用盡，仍然發生版本衝突
+	ErrConflict = errors.New("kv: too many conflicts on update")
+	// ErrInvalidPrototype 建立 Store 時給的 prototype 不是指標
+	ErrInvalidPrototype = errors.New("kv: prototype must be a non-nil pointer")
+)
+
+// Entry 一筆解碼後的資料，Value 是與 prototype 相同型別的指標
+type Entry struct {
+	Key            string
+	Value          interface{}
+	CreateRevision int64
+	ModRevision    int64
+	Version        int64
+	Lease          int64
+}
+
+type EventType int
+
+const (
+	// EventPut key 被新增或修改
+	EventPut EventType = iota
+	// EventDelete key 被刪除或過期，Entry.Value 為 nil
+	EventDelete
+)
+
+// Event Watch 收到的變動，解碼失敗時 Err 不為 nil
+type Event struct {
+	Type EventType
+	Entry
+	Err error
+}
+
+// Store 在 etcd 上以 prefix 為命名空間，存放同一種型別的資料
+type Store struct {
+	client    *etcdv3.Client
+	prefix    string
+	valueType reflect.Type
+	options   Options
+	logger    *dlog.Logger
+}
+
+// New 建立 Store，prototype 是資料型別的指標，例如 &User{}，解碼時會依照它的型別建立新的值
+func New(client *etcdv3.Client, prefix string, prototype interface{}, options ...Option) (*Store, error) {
+	value := reflect.ValueOf(prototype)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return nil, ErrInvalidPrototype
+	}
+	return &Store{
+		client:    client,
+		prefix:    prefix,
+		valueType: value.Type().Elem(),
+		options:   *loadOptions(options...),
+		logger:    client.Logger().With(dlog.FieldMod("client.etcd.kv")),
+	}, nil
+}
+
+// Get 取得 key 的資料，不存在時返回 ErrNotFound
+func (store *Store) Get(ctx context.Context, key string) (*Entry, error) {
+	resp, err := store.client.Get(ctx, store.fullKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+	return store.decode(resp.Kvs[0])
+}
+
+// Put 寫入資料，返回寫入後的 revision
+func (store *Store) Put(ctx context.Context, key string, value interface{}, options ...PutOption) (int64, error) {
+	data, err := store.options.Codec.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	opts := putOptions{ttl: store.options.TTL}
+	for _, option := range options {
+		option(&opts)
+	}
+	lease, err := store.grant(ctx, opts.ttl)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := store.client.Put(ctx, store.fullKey(key), string(data), clientv3.WithLease(lease))
+	if err != nil {
+		return 0, err
+	}
+	return resp.Header.GetRevision(), nil
+}
+
+// Delete 刪除資料，返回 key 原本是否存在
+func (store *Store) Delete(ctx context.Context, key string) (bool, error) {
+	resp, err := store.client.Delete(ctx, store.fullKey(key))
+	if err != nil {
+		return false, err
+	}
+	return resp.Deleted > 0, nil
+}
+
+// List 列出 prefix 底下所有的資料，依照 key 排序
+func (store *Store) List(ctx context.Context) ([]*Entry, error) {
+	resp, err := store.client.Get(ctx, store.prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		entry, err := store.decode(kv)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Update 以樂觀鎖的方式讀取、修改、寫回，mod revision 不一致時重新讀取再試一次，
+// key 不存在時 fn 收到的 old 為 nil，fn 返回錯誤時直接中止
+func (store *Store) Update(ctx context.Context, key string, fn func(old interface{}) (interface{}, error)) (entry *Entry, err error) {
+	fullKey := store.fullKey(key)
+	// 設定 TTL 時只建立一次 lease，每次重試共用，沒有寫入成功時撤銷
+	granted := clientv3.NoLease
+	defer func() {
+		if err != nil && granted != clientv3.NoLease {
+			store.revoke(ctx, granted)
+		}
+	}()
+	for attempt := 0; attempt <= store.options.MaxRetries; attempt++ {
+		resp, err := store.client.Get(ctx, fullKey)
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			old      interface{}
+			revision int64
+			lease    int64
+		)
+		if len(resp.Kvs) > 0 {
+			current, err := store.decode(resp.Kvs[0])
+			if err != nil {
+				return nil, err
+			}
+			old, revision, lease = current.Value, current.ModRevision, current.Lease
+		}
+
+		value, err := fn(old)
+		if err != nil {
+			return nil, err
+		}
+		data, err := store.options.Codec.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		// 沒有設定 TTL 時沿用原本的 lease，避免更新後失去存活時間
+		if store.options.TTL > 0 {
+			if granted == clientv3.NoLease {
+				if granted, err = store.grant(ctx, store.options.TTL); err != nil {
+					return nil, err
+				}
+			}
+			lease = int64(granted)
+		}
+
+		txn, err := store.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(fullKey), "=", revision)).
+			Then(clientv3.OpPut(fullKey, string(data), clientv3.WithLease(clientv3.LeaseID(lease)))).
+			Commit()
+		if err != nil {
+			return nil, err
+		}
+		if txn.Succeeded {
+			entry = &Entry{
+				Key:            key,
+				Value:          value,
+				CreateRevision: txn.Header.GetRevision(),
+				ModRevision:    txn.Header.GetRevision(),
+				Version:        1,
+				Lease:          lease,
+			}
+			if len(resp.Kvs) > 0 {
+				entry.CreateRevision = resp.Kvs[0].CreateRevision
+				entry.Version = resp.Kvs[0].Version + 1
+			}
+			return entry, nil
+		}
+		store.logger.Debug("kv update conflict", dlog.FieldKey(fullKey), dlog.Int("attempt", attempt))
+	}
+	return nil, ErrConflict
+}
+
+// Watch 監看 prefix 底下的變動，revision 為 0 時從目前開始，ctx 結束時關閉 channel
+func (store *Store) Watch(ctx context.Context, revision int64) <-chan Event {
+	events := make(chan Event, 100)
+	go func() {
+		defer close(events)
+		for ctx.Err() == nil {
+			opts := []clientv3.OpOption{clientv3.WithPrefix()}
+			if revision > 0 {
+				opts = append(opts, clientv3.WithRev(revision))
+			}
+			for resp := range store.client.Watch(ctx, store.prefix, opts...) {
+				if resp.CompactRevision > revision {
+					revision = resp.CompactRevision
+				}
+				if err := resp.Err(); err != nil {
+					store.logger.Error("kv watch", dlog.FieldErr(err), dlog.FieldKey(store.prefix))
+					continue
+				}
+				for _, ev := range resp.Events {
+					event := store.event(ev)
+					select {
+					case events <- event:
+					case <-ctx.Done():
+						return
+					}
+					revision = ev.Kv.ModRevision + 1
+				}
+			}
+			// 連線中斷後稍等一下，再從最後的 revision 繼續
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return events
+}
+
+func (store *Store) event(ev *clientv3.Event) Event {
+	if ev.Type == mvccpb.DELETE {
+		return Event{
+			Type: EventDelete,
+			Entry: Entry{
+				Key:         store.trimKey(string(ev.Kv.Key)),
+				ModRevision: ev.Kv.ModRevision,
+			},
+		}
+	}
+	entry, err := store.decode(ev.Kv)
+	if err != nil {
+		return Event{Type: EventPut, Entry: Entry{Key: store.trimKey(string(ev.Kv.Key)), ModRevision: ev.Kv.ModRevision}, Err: err}
+	}
+	return Event{Type: EventPut, Entry: *entry}
+}
+
+func (store *Store) decode(kv *mvccpb.KeyValue) (*Entry, error) {
+	value := reflect.New(store.valueType).Interface()
+	if err := store.options.Codec.Unmarshal(kv.Value, value); err != nil {
+		return nil, err
+	}
+	return &Entry{
+		Key:            store.trimKey(string(kv.Key)),
+		Value:          value,
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Version:        kv.Version,
+		Lease:          kv.Lease,
+	}, nil
+}
+
+// grant 依照 ttl 建立 lease，ttl 不足一秒以一秒計算，ttl 為 0 時不建立
+func (store *Store) grant(ctx context.Context, ttl time.Duration) (clientv3.LeaseID, error) {
+	if ttl <= 0 {
+		return clientv3.NoLease, nil
+	}
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	lease, err := store.client.Grant(ctx, seconds)
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+	return lease.ID, nil
+}
+
+// revoke 撤銷沒有用到的 lease，失敗時 lease 仍會在 TTL 到期後失效
+func (store *Store) revoke(ctx context.Context, lease clientv3.LeaseID) {
+	if _, err := store.client.Revoke(ctx, lease); err != nil {
+		store.logger.Warn("kv revoke unused lease", dlog.FieldErr(err), dlog.Int64("lease", int64(lease)))
+	}
+}
+
+func (store *Store) fullKey(key string) string {
+	return store.prefix + key
+}
+
+func (store *Store) trimKey(key string) string {
+	return strings.TrimPrefix(key, store.prefix)
+}
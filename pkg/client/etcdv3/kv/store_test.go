@@ -0,0 +1,210 @@
+package kv
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type user struct {
+	Name  string `json:"name" msgpack:"name"`
+	Count int    `json:"count" msgpack:"count"`
+}
+
+func TestStore_CRUD(t *testing.T) {
+	store, err := New(newTestClient(t), "/test/users/", &user{})
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	_, err = store.Get(ctx, "a")
+	assert.Equal(t, ErrNotFound, err)
+
+	_, err = store.Put(ctx, "a", &user{Name: "a"})
+	assert.Nil(t, err)
+	_, err = store.Put(ctx, "b", user{Name: "b", Count: 2})
+	assert.Nil(t, err)
+
+	entry, err := store.Get(ctx, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", entry.Key)
+	assert.Equal(t, &user{Name: "b", Count: 2}, entry.Value)
+
+	entries, err := store.List(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "a", entries[0].Key)
+	assert.Equal(t, "b", entries[1].Key)
+
+	deleted, err := store.Delete(ctx, "a")
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	deleted, err = store.Delete(ctx, "a")
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+}
+
+func TestStore_InvalidPrototype(t *testing.T) {
+	_, err := New(nil, "/test/", user{})
+	assert.Equal(t, ErrInvalidPrototype, err)
+}
+
+func TestStore_UpdateConcurrent(t *testing.T) {
+	client := newTestClient(t)
+	store, err := New(client, "/test/counter/", &user{}, WithMaxRetries(100))
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Update(ctx, "c", func(old interface{}) (interface{}, error) {
+				if old == nil {
+					return &user{Name: "c", Count: 1}, nil
+				}
+				u := old.(*user)
+				u.Count++
+				return u, nil
+			})
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	entry, err := store.Get(ctx, "c")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, entry.Value.(*user).Count)
+	assert.Equal(t, int64(10), entry.Version)
+}
+
+func TestStore_UpdateConflict(t *testing.T) {
+	store, err := New(newTestClient(t), "/test/conflict/", &user{}, WithMaxRetries(2))
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	// 每次修改時都有另一個寫入搶先，讓 Update 一直衝突
+	_, err = store.Update(ctx, "k", func(old interface{}) (interface{}, error) {
+		_, err := store.Put(ctx, "k", &user{Name: "other"})
+		return &user{Name: "mine"}, err
+	})
+	assert.Equal(t, ErrConflict, err)
+}
+
+func TestStore_UpdateLease(t *testing.T) {
+	client := newTestClient(t)
+	store, err := New(client, "/test/lease/", &user{}, WithTTL(30*time.Second), WithMaxRetries(2))
+	assert.Nil(t, err)
+	ctx := context.Background()
+	leases := func() int {
+		resp, err := client.Leases(ctx)
+		assert.Nil(t, err)
+		return len(resp.Leases)
+	}
+
+	// 衝突的重試共用同一個 lease，最後失敗時撤銷
+	_, err = store.Update(ctx, "k", func(old interface{}) (interface{}, error) {
+		_, err := client.Put(ctx, "/test/lease/k", `{"name":"other"}`)
+		return &user{Name: "mine"}, err
+	})
+	assert.Equal(t, ErrConflict, err)
+	assert.Equal(t, 0, leases())
+
+	// 衝突一次之後成功，只留下寫入使用的 lease
+	conflicted := false
+	entry, err := store.Update(ctx, "k", func(old interface{}) (interface{}, error) {
+		if !conflicted {
+			conflicted = true
+			_, err := client.Put(ctx, "/test/lease/k", `{"name":"other"}`)
+			return &user{Name: "mine"}, err
+		}
+		return &user{Name: "mine"}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, leases())
+	assert.NotZero(t, entry.Lease)
+}
+
+func TestStore_TTL(t *testing.T) {
+	client := newTestClient(t)
+	store, err := New(client, "/test/ttl/", &user{}, WithTTL(30*time.Second))
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	_, err = store.Put(ctx, "k", &user{Name: "k"})
+	assert.Nil(t, err)
+	_, err = store.Put(ctx, "short", &user{Name: "short"}, PutWithTTL(time.Second))
+	assert.Nil(t, err)
+
+	entry, err := store.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.NotZero(t, entry.Lease)
+
+	// 過期之後 key 會被刪除
+	assert.Eventually(t, func() bool {
+		_, err := store.Get(ctx, "short")
+		return err == ErrNotFound
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestStore_Watch(t *testing.T) {
+	store, err := New(newTestClient(t), "/test/watch/", &user{})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := store.Watch(ctx, 0)
+	// 等 watch 建立
+	time.Sleep(100 * time.Millisecond)
+	_, err = store.Put(ctx, "a", &user{Name: "a"})
+	assert.Nil(t, err)
+	_, err = store.Delete(ctx, "a")
+	assert.Nil(t, err)
+
+	event := <-events
+	assert.Equal(t, EventPut, event.Type)
+	assert.Equal(t, "a", event.Key)
+	assert.Equal(t, &user{Name: "a"}, event.Value)
+	event = <-events
+	assert.Equal(t, EventDelete, event.Type)
+	assert.Equal(t, "a", event.Key)
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	for _, codec := range []Codec{JSON, MsgPack} {
+		data, err := codec.Marshal(&user{Name: "a", Count: 1})
+		assert.Nil(t, err, codec.Name())
+		out := &user{}
+		assert.Nil(t, codec.Unmarshal(data, out), codec.Name())
+		assert.Equal(t, &user{Name: "a", Count: 1}, out, codec.Name())
+	}
+
+	data, err := Proto.Marshal(wrapperspb.String("a"))
+	assert.Nil(t, err)
+	out := &wrapperspb.StringValue{}
+	assert.Nil(t, Proto.Unmarshal(data, out))
+	assert.Equal(t, "a", out.GetValue())
+
+	_, err = Proto.Marshal(&user{})
+	assert.NotNil(t, err)
+}
+
+func TestStore_ProtoCodec(t *testing.T) {
+	store, err := New(newTestClient(t), "/test/proto/", &wrapperspb.StringValue{}, WithCodec(Proto))
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	_, err = store.Put(ctx, "a", wrapperspb.String("value"))
+	assert.Nil(t, err)
+	entry, err := store.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "value", entry.Value.(*wrapperspb.StringValue).GetValue())
+}
@@ -0,0 +1,164 @@
+package etcdv3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+var (
+	// ErrInvalidSemaphoreLimit semaphore 的上限必須大於 0
+	ErrInvalidSemaphoreLimit = errors.New("semaphore limit must be positive")
+	// ErrSemaphoreFull TryAcquire 時名額已滿
+	ErrSemaphoreFull = errors.New("semaphore is full")
+	// ErrWatchClosed 等待事件時 watch 被關閉
+	ErrWatchClosed = errors.New("watch closed before event arrived")
+)
+
+// Semaphore 分散式的計數信號量，最多 limit 個持有者，
+// 等待者依照進入的先後順序（create revision）取得名額，不會被後來的人插隊
+type Semaphore struct {
+	s     *concurrency.Session
+	pfx   string
+	limit int
+	myKey string
+	// myRev 自己的 create revision，Position 可能在其他 goroutine 呼叫，以 atomic 存取
+	myRev int64
+}
+
+// NewSemaphore ...
+func (client *Client) NewSemaphore(key string, limit int, opts ...concurrency.SessionOption) (semaphore *Semaphore, err error) {
+	if limit <= 0 {
+		return nil, ErrInvalidSemaphoreLimit
+	}
+	semaphore = &Semaphore{pfx: key + "/", limit: limit}
+	// 默认session ttl = 60s
+	semaphore.s, err = concurrency.NewSession(client.Client, opts...)
+	if err != nil {
+		return nil, err
+	}
+	semaphore.myKey = fmt.Sprintf("%s%x", semaphore.pfx, semaphore.s.Lease())
+	return
+}
+
+// Acquire 等待直到取得名額或超時
+func (semaphore *Semaphore) Acquire(timeout time.Duration) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return semaphore.AcquireContext(ctx)
+}
+
+// AcquireContext 等待直到取得名額或 ctx 結束，沒有取得時會離開等待隊列
+func (semaphore *Semaphore) AcquireContext(ctx context.Context) (err error) {
+	if err = semaphore.enqueue(ctx); err != nil {
+		return
+	}
+	for {
+		var ahead int
+		var revision int64
+		if ahead, revision, err = semaphore.ahead(ctx); err != nil {
+			break
+		}
+		if ahead < semaphore.limit {
+			return nil
+		}
+		// 前面有人離開時再檢查一次
+		if err = waitEvent(ctx, semaphore.s.Client(), semaphore.pfx, revision+1, mvccpb.DELETE, clientv3.WithPrefix()); err != nil {
+			break
+		}
+	}
+	semaphore.dequeue()
+	return
+}
+
+// TryAcquire 不等待其他持有者釋放，名額已滿時返回 ErrSemaphoreFull，timeout 只限制與 etcd 溝通的時間
+func (semaphore *Semaphore) TryAcquire(timeout time.Duration) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err = semaphore.enqueue(ctx); err != nil {
+		return
+	}
+	ahead, _, err := semaphore.ahead(ctx)
+	if err == nil && ahead >= semaphore.limit {
+		err = ErrSemaphoreFull
+	}
+	if err != nil {
+		semaphore.dequeue()
+	}
+	return
+}
+
+// Position 排在自己前面的人數，小於 limit 表示已持有名額
+func (semaphore *Semaphore) Position(ctx context.Context) (int, error) {
+	ahead, _, err := semaphore.ahead(ctx)
+	return ahead, err
+}
+
+// Release 釋放名額並關閉 session
+func (semaphore *Semaphore) Release() (err error) {
+	if _, err = semaphore.s.Client().Delete(context.TODO(), semaphore.myKey); err != nil {
+		return
+	}
+	return semaphore.s.Close()
+}
+
+// enqueue 以 session 的 lease 建立自己的 key，已存在時沿用原本的 create revision
+func (semaphore *Semaphore) enqueue(ctx context.Context) error {
+	cmp := clientv3.Compare(clientv3.CreateRevision(semaphore.myKey), "=", 0)
+	put := clientv3.OpPut(semaphore.myKey, "", clientv3.WithLease(semaphore.s.Lease()))
+	get := clientv3.OpGet(semaphore.myKey)
+	resp, err := semaphore.s.Client().Txn(ctx).If(cmp).Then(put).Else(get).Commit()
+	if err != nil {
+		return err
+	}
+	myRev := resp.Header.Revision
+	if !resp.Succeeded {
+		myRev = resp.Responses[0].GetResponseRange().Kvs[0].CreateRevision
+	}
+	atomic.StoreInt64(&semaphore.myRev, myRev)
+	return nil
+}
+
+// ahead 計算比自己早進入的 key 數量
+func (semaphore *Semaphore) ahead(ctx context.Context) (int, int64, error) {
+	// server 端的 Count 是過濾 create revision 之前的數量，所以要用 Kvs 的長度
+	resp, err := semaphore.s.Client().Get(ctx, semaphore.pfx, clientv3.WithPrefix(), clientv3.WithMaxCreateRev(atomic.LoadInt64(&semaphore.myRev)-1), clientv3.WithKeysOnly())
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(resp.Kvs), resp.Header.Revision, nil
+}
+
+// dequeue 放棄等待，ctx 可能已經結束，所以另外給一個期限
+func (semaphore *Semaphore) dequeue() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _ = semaphore.s.Client().Delete(ctx, semaphore.myKey)
+}
+
+// waitEvent 從 revision 開始監看 key，直到出現指定類型的事件
+func waitEvent(ctx context.Context, client *clientv3.Client, key string, revision int64, evType mvccpb.Event_EventType, opts ...clientv3.OpOption) error {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wch := client.Watch(wctx, key, append(opts, clientv3.WithRev(revision))...)
+	for resp := range wch {
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range resp.Events {
+			if ev.Type == evType {
+				return nil
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ErrWatchClosed
+}
@@ -0,0 +1,138 @@
+package etcdv3
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemaphore(t *testing.T) {
+	etcdCli := newTestClient(t)
+
+	_, err := etcdCli.NewSemaphore("/test/sem", 0)
+	assert.Equal(t, ErrInvalidSemaphoreLimit, err)
+
+	sem1, err := etcdCli.NewSemaphore("/test/sem", 2, concurrency.WithTTL(5))
+	assert.Nil(t, err)
+	sem2, err := etcdCli.NewSemaphore("/test/sem", 2, concurrency.WithTTL(5))
+	assert.Nil(t, err)
+	sem3, err := etcdCli.NewSemaphore("/test/sem", 2, concurrency.WithTTL(5))
+	assert.Nil(t, err)
+	defer sem3.Release()
+
+	assert.Nil(t, sem1.Acquire(time.Second))
+	assert.Nil(t, sem2.TryAcquire(time.Second))
+	assert.Equal(t, ErrSemaphoreFull, sem3.TryAcquire(time.Second))
+	assert.Equal(t, context.DeadlineExceeded, sem3.Acquire(200*time.Millisecond))
+
+	// 逾時後離開隊列，不會佔住名額
+	position, err := sem3.Position(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, position)
+
+	done := make(chan error)
+	go func() {
+		done <- sem3.Acquire(5 * time.Second)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, sem1.Release())
+	assert.Nil(t, <-done)
+	assert.Nil(t, sem2.Release())
+}
+
+func TestSemaphore_FIFO(t *testing.T) {
+	etcdCli := newTestClient(t)
+
+	holder, err := etcdCli.NewSemaphore("/test/fifo", 1, concurrency.WithTTL(5))
+	assert.Nil(t, err)
+	assert.Nil(t, holder.Acquire(time.Second))
+
+	var (
+		order []int
+		lock  sync.Mutex
+		wg    sync.WaitGroup
+	)
+	waiters := make([]*Semaphore, 3)
+	for i := range waiters {
+		waiters[i], err = etcdCli.NewSemaphore("/test/fifo", 1, concurrency.WithTTL(5))
+		assert.Nil(t, err)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, waiters[i].Acquire(10*time.Second))
+			lock.Lock()
+			order = append(order, i)
+			lock.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			assert.Nil(t, waiters[i].Release())
+		}(i)
+		// 確認已經排進隊列，再讓下一個進入
+		assert.Eventually(t, func() bool {
+			position, err := waiters[i].Position(context.Background())
+			return err == nil && position == i+1
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	assert.Nil(t, holder.Release())
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2}, order)
+}
+
+func TestDoubleBarrier(t *testing.T) {
+	etcdCli := newTestClient(t)
+	const count = 3
+
+	var (
+		entered int32
+		left    int32
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < count; i++ {
+		barrier, err := etcdCli.NewDoubleBarrier("/test/barrier", count, concurrency.WithTTL(5))
+		assert.Nil(t, err)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer barrier.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// 錯開進入的時間，先進入的人必須等到最後一個人
+			time.Sleep(time.Duration(i) * 50 * time.Millisecond)
+			atomic.AddInt32(&entered, 1)
+			assert.Nil(t, barrier.Enter(ctx))
+			assert.Equal(t, int32(count), atomic.LoadInt32(&entered))
+
+			time.Sleep(time.Duration(count-i) * 50 * time.Millisecond)
+			atomic.AddInt32(&left, 1)
+			assert.Nil(t, barrier.Leave(ctx))
+			assert.Equal(t, int32(count), atomic.LoadInt32(&left))
+		}(i)
+	}
+	wg.Wait()
+
+	resp, err := etcdCli.GetPrefix(context.Background(), "/test/barrier")
+	assert.Nil(t, err)
+	assert.Empty(t, resp)
+}
+
+func TestDoubleBarrier_TooManyParticipants(t *testing.T) {
+	etcdCli := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	first, err := etcdCli.NewDoubleBarrier("/test/full", 1, concurrency.WithTTL(5))
+	assert.Nil(t, err)
+	defer first.Close()
+	assert.Nil(t, first.Enter(ctx))
+
+	second, err := etcdCli.NewDoubleBarrier("/test/full", 1, concurrency.WithTTL(5))
+	assert.Nil(t, err)
+	defer second.Close()
+	assert.Equal(t, ErrTooManyParticipants, second.Enter(ctx))
+}
@@ -0,0 +1,179 @@
+package etcdv3
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/digital-monster-1997/digicore/pkg/dlog"
+	"github.com/fsnotify/fsnotify"
+)
+
+var (
+	// ErrInvalidCaCert CaCert 檔案中沒有任何可用的 PEM 憑證
+	ErrInvalidCaCert = errors.New("client etcd ca cert contains no valid certificate")
+	// ErrIncompleteKeyPair 只設定了 CerFile 或 KeyFile 其中一個
+	ErrIncompleteKeyPair = errors.New("client etcd cert file and key file must be set together")
+)
+
+// tlsVersions min_tls_version 可以使用的值
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsEnabled 設定了 Secure 或任何憑證時就使用 TLS 連線
+func (config *Config) tlsEnabled() bool {
+	return config.Secure || config.CaCert != "" || config.CerFile != "" || config.KeyFile != ""
+}
+
+// buildTLSConfig 依照設定組出 tls.Config，不需要 TLS 時返回 nil，
+// 有設定 client 憑證時會一併返回監看憑證檔案的 certReloader
+func (config *Config) buildTLSConfig() (*tls.Config, *certReloader, error) {
+	if !config.tlsEnabled() {
+		return nil, nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.MinTLSVersion != "" {
+		version, ok := tlsVersions[config.MinTLSVersion]
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported min tls version %q", config.MinTLSVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	// 沒有設定 CaCert 時使用系統的根憑證
+	if config.CaCert != "" {
+		certBytes, err := ioutil.ReadFile(config.CaCert)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse CaCert failed: %w", err)
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(certBytes) {
+			return nil, nil, ErrInvalidCaCert
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	if config.CerFile == "" && config.KeyFile == "" {
+		return tlsConfig, nil, nil
+	}
+	if config.CerFile == "" || config.KeyFile == "" {
+		return nil, nil, ErrIncompleteKeyPair
+	}
+	reloader, err := newCertReloader(config.CerFile, config.KeyFile, config.logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+	return tlsConfig, reloader, nil
+}
+
+// certReloader 持有目前的 client 憑證，憑證檔案變動時重新載入，
+// 新的憑證會在下一次 TLS 握手時生效
+type certReloader struct {
+	certFile string
+	keyFile  string
+	lock     sync.RWMutex
+	cert     *tls.Certificate
+	watcher  *fsnotify.Watcher
+	logger   *dlog.Logger
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newCertReloader(certFile, keyFile string, logger *dlog.Logger) (*certReloader, error) {
+	reloader := &certReloader{
+		certFile: filepath.Clean(certFile),
+		keyFile:  filepath.Clean(keyFile),
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// 監看目錄而不是檔案，才能收到以 rename 方式替換檔案的事件
+	dirs := map[string]struct{}{
+		filepath.Dir(reloader.certFile): {},
+		filepath.Dir(reloader.keyFile):  {},
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return nil, err
+		}
+	}
+	reloader.watcher = watcher
+	go reloader.watch()
+	return reloader, nil
+}
+
+// GetClientCertificate 給 tls.Config 使用，返回目前的憑證
+func (reloader *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	reloader.lock.RLock()
+	defer reloader.lock.RUnlock()
+	return reloader.cert, nil
+}
+
+func (reloader *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return fmt.Errorf("load CertFile or KeyFile failed: %w", err)
+	}
+	reloader.lock.Lock()
+	reloader.cert = &cert
+	reloader.lock.Unlock()
+	return nil
+}
+
+func (reloader *certReloader) watch() {
+	const writeOrCreateMask = fsnotify.Write | fsnotify.Create
+	for {
+		select {
+		case event, ok := <-reloader.watcher.Events:
+			if !ok {
+				return
+			}
+			name := filepath.Clean(event.Name)
+			if event.Op&writeOrCreateMask == 0 || (name != reloader.certFile && name != reloader.keyFile) {
+				continue
+			}
+			// cert 與 key 可能分兩次寫入，載入失敗時保留舊的憑證，等下一次事件
+			if err := reloader.reload(); err != nil {
+				reloader.logger.Warn("reload etcd client cert", dlog.FieldErr(err), dlog.FieldName(name))
+				continue
+			}
+			reloader.logger.Info("reload etcd client cert", dlog.FieldName(name))
+		case err, ok := <-reloader.watcher.Errors:
+			if !ok {
+				return
+			}
+			reloader.logger.Error("watch etcd client cert", dlog.FieldErr(err))
+		case <-reloader.done:
+			return
+		}
+	}
+}
+
+func (reloader *certReloader) stop() {
+	reloader.once.Do(func() {
+		close(reloader.done)
+		_ = reloader.watcher.Close()
+	})
+}
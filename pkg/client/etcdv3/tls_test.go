@@ -0,0 +1,227 @@
+package etcdv3
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+	"github.com/digital-monster-1997/digicore/pkg/client/etcdv3/etcdtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert 產生憑證，parent 為 nil 時產生自簽的 CA
+func newTestCert(t *testing.T, serial int64, parent *testCert, client bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "digicore"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	switch {
+	case parent == nil:
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	case client:
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	default:
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		template.DNSNames = []string{"etcd.local"}
+	}
+
+	signer := &testCert{cert: template, key: key}
+	if parent != nil {
+		signer = parent
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.cert, &key.PublicKey, signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+// write 把憑證與私鑰寫入 dir，返回檔案路徑
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+type tlsFiles struct {
+	dir        string
+	ca         *testCert
+	caFile     string
+	clientCert string
+	clientKey  string
+}
+
+// startTLSEtcd 啟動要求 client 憑證的 etcd
+func startTLSEtcd(t *testing.T) (string, *tlsFiles) {
+	dir := t.TempDir()
+	ca := newTestCert(t, 1, nil, false)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCert, serverKey := newTestCert(t, 2, ca, false).write(t, dir, "server")
+	clientCert, clientKey := newTestCert(t, 3, ca, true).write(t, dir, "client")
+
+	endpoint := etcdtest.Start(t, func(cfg *embed.Config) {
+		cfg.LCUrls[0].Scheme = "https"
+		cfg.ACUrls[0].Scheme = "https"
+		cfg.ClientTLSInfo.CertFile = serverCert
+		cfg.ClientTLSInfo.KeyFile = serverKey
+		cfg.ClientTLSInfo.TrustedCAFile = caFile
+		cfg.ClientTLSInfo.ClientCertAuth = true
+	})
+	return endpoint, &tlsFiles{dir: dir, ca: ca, caFile: caFile, clientCert: clientCert, clientKey: clientKey}
+}
+
+func buildWithTimeout(config *Config) (*Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return config.BuildE(ctx)
+}
+
+func TestTLS_MutualAuth(t *testing.T) {
+	endpoint, files := startTLSEtcd(t)
+
+	config := DefaultConfig()
+	config.Endpoints = []string{endpoint}
+	config.CaCert = files.caFile
+	config.CerFile = files.clientCert
+	config.KeyFile = files.clientKey
+	config.ServerName = "etcd.local"
+	config.MinTLSVersion = "1.2"
+
+	etcdCli, err := buildWithTimeout(config)
+	assert.Nil(t, err)
+	defer etcdCli.Close()
+
+	ctx := context.Background()
+	_, err = etcdCli.Put(ctx, "/test/tls", "ok")
+	assert.Nil(t, err)
+	keyValue, err := etcdCli.GetKeyValue(ctx, "/test/tls")
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", string(keyValue.Value))
+}
+
+func TestTLS_WithoutClientCert(t *testing.T) {
+	endpoint, files := startTLSEtcd(t)
+
+	config := DefaultConfig()
+	config.Endpoints = []string{endpoint}
+	config.CaCert = files.caFile
+
+	_, err := buildWithTimeout(config)
+	assert.NotNil(t, err)
+}
+
+func TestTLS_UnknownCA(t *testing.T) {
+	endpoint, files := startTLSEtcd(t)
+	otherCA, _ := newTestCert(t, 10, nil, false).write(t, t.TempDir(), "other")
+
+	config := DefaultConfig()
+	config.Endpoints = []string{endpoint}
+	config.CaCert = otherCA
+	config.CerFile = files.clientCert
+	config.KeyFile = files.clientKey
+
+	_, err := buildWithTimeout(config)
+	assert.NotNil(t, err)
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	config := DefaultConfig()
+	tlsConfig, _, err := config.buildTLSConfig()
+	assert.Nil(t, err)
+	assert.Nil(t, tlsConfig)
+
+	config.Secure = true
+	tlsConfig, _, err = config.buildTLSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.Nil(t, tlsConfig.RootCAs)
+
+	config.MinTLSVersion = "1.3"
+	tlsConfig, _, err = config.buildTLSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+
+	config.MinTLSVersion = "9.9"
+	_, _, err = config.buildTLSConfig()
+	assert.NotNil(t, err)
+
+	config.MinTLSVersion = ""
+	config.CerFile = "client.pem"
+	_, _, err = config.buildTLSConfig()
+	assert.Equal(t, ErrIncompleteKeyPair, err)
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	assert.Nil(t, ioutil.WriteFile(empty, []byte("not a cert"), 0600))
+	config.CerFile = ""
+	config.CaCert = empty
+	_, _, err = config.buildTLSConfig()
+	assert.Equal(t, ErrInvalidCaCert, err)
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, 1, nil, false)
+	certFile, keyFile := newTestCert(t, 2, ca, true).write(t, dir, "client")
+
+	reloader, err := newCertReloader(certFile, keyFile, DefaultConfig().logger)
+	assert.Nil(t, err)
+	defer reloader.stop()
+
+	serial := func() int64 {
+		cert, _ := reloader.GetClientCertificate(nil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return 0
+		}
+		return leaf.SerialNumber.Int64()
+	}
+	assert.Equal(t, int64(2), serial())
+
+	newTestCert(t, 3, ca, true).write(t, dir, "client")
+	assert.Eventually(t, func() bool {
+		return serial() == 3
+	}, 2*time.Second, 20*time.Millisecond)
+}
@@ -0,0 +1,201 @@
+package etcdv3
+
+import (
+	"context"
+	"errors"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+)
+
+// DefaultMaxTxnOps etcd server 預設 --max-txn-ops 的值
+const DefaultMaxTxnOps = 128
+
+// ErrTooManyTxnOps 單一交易的比較或操作數量超過 MaxTxnOps
+var ErrTooManyTxnOps = errors.New("too many operations in txn")
+
+// ModRevisionEquals key 的 mod revision 等於 revision，key 不存在時 mod revision 為 0
+func ModRevisionEquals(key string, revision int64) clientv3.Cmp {
+	return clientv3.Compare(clientv3.ModRevision(key), "=", revision)
+}
+
+// VersionEquals key 的 version 等於 version
+func VersionEquals(key string, version int64) clientv3.Cmp {
+	return clientv3.Compare(clientv3.Version(key), "=", version)
+}
+
+// ValueEquals key 的值等於 value
+func ValueEquals(key, value string) clientv3.Cmp {
+	return clientv3.Compare(clientv3.Value(key), "=", value)
+}
+
+// KeyMissing key 不存在
+func KeyMissing(key string) clientv3.Cmp {
+	return clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+}
+
+// KeyExists key 存在
+func KeyExists(key string) clientv3.Cmp {
+	return clientv3.Compare(clientv3.CreateRevision(key), ">", 0)
+}
+
+// TxnBuilder 組合交易，和 clientv3.Txn 不同的是 If、Then、Else 可以重複呼叫，
+// 內容會累加，並且在送出前檢查數量
+type TxnBuilder struct {
+	client  *Client
+	ctx     context.Context
+	cmps    []clientv3.Cmp
+	thenOps []clientv3.Op
+	elseOps []clientv3.Op
+}
+
+// NewTxn 建立交易
+func (client *Client) NewTxn(ctx context.Context) *TxnBuilder {
+	return &TxnBuilder{client: client, ctx: ctx}
+}
+
+// If 加入比較條件，所有條件都成立時執行 Then，否則執行 Else
+func (txn *TxnBuilder) If(cmps ...clientv3.Cmp) *TxnBuilder {
+	txn.cmps = append(txn.cmps, cmps...)
+	return txn
+}
+
+// Then 加入條件成立時的操作
+func (txn *TxnBuilder) Then(ops ...clientv3.Op) *TxnBuilder {
+	txn.thenOps = append(txn.thenOps, ops...)
+	return txn
+}
+
+// Else 加入條件不成立時的操作
+func (txn *TxnBuilder) Else(ops ...clientv3.Op) *TxnBuilder {
+	txn.elseOps = append(txn.elseOps, ops...)
+	return txn
+}
+
+// Commit 送出交易
+func (txn *TxnBuilder) Commit() (*clientv3.TxnResponse, error) {
+	maxOps := txn.client.maxTxnOps()
+	if len(txn.cmps) > maxOps || len(txn.thenOps) > maxOps || len(txn.elseOps) > maxOps {
+		return nil, ErrTooManyTxnOps
+	}
+	return txn.client.Txn(txn.ctx).If(txn.cmps...).Then(txn.thenOps...).Else(txn.elseOps...).Commit()
+}
+
+// GetMany 讀取多個 key，超過 MaxTxnOps 時會拆成多個交易，並且都讀取第一個交易的 revision，
+// 結果是同一個時間點的快照，不存在的 key 不會出現在結果中
+func (client *Client) GetMany(ctx context.Context, keys ...string) (map[string]string, int64, error) {
+	var (
+		vars     = make(map[string]string, len(keys))
+		revision = int64(0)
+	)
+	err := client.chunk(len(keys), func(start, end int) error {
+		ops := make([]clientv3.Op, 0, end-start)
+		for _, key := range keys[start:end] {
+			ops = append(ops, clientv3.OpGet(key, clientv3.WithRev(revision)))
+		}
+		resp, err := client.Txn(ctx).Then(ops...).Commit()
+		if err != nil {
+			return err
+		}
+		for _, r := range resp.Responses {
+			for _, kv := range r.GetResponseRange().Kvs {
+				vars[string(kv.Key)] = string(kv.Value)
+			}
+		}
+		if revision == 0 {
+			revision = resp.Header.GetRevision()
+		}
+		return nil
+	})
+	return vars, revision, err
+}
+
+// PutMany 寫入多個 key，超過 MaxTxnOps 時會拆成多個交易，
+// 每個交易各自是原子的，但交易之間不是，中途失敗時前面的交易已經寫入
+func (client *Client) PutMany(ctx context.Context, kvs map[string]string, opts ...clientv3.OpOption) error {
+	ops := make([]clientv3.Op, 0, len(kvs))
+	for key, value := range kvs {
+		ops = append(ops, clientv3.OpPut(key, value, opts...))
+	}
+	return client.chunk(len(ops), func(start, end int) error {
+		_, err := client.Txn(ctx).Then(ops[start:end]...).Commit()
+		return err
+	})
+}
+
+// DeleteMany 刪除多個 key，拆分方式與 PutMany 相同，返回實際刪除的數量
+func (client *Client) DeleteMany(ctx context.Context, keys ...string) (int64, error) {
+	var deleted int64
+	err := client.chunk(len(keys), func(start, end int) error {
+		ops := make([]clientv3.Op, 0, end-start)
+		for _, key := range keys[start:end] {
+			ops = append(ops, clientv3.OpDelete(key))
+		}
+		resp, err := client.Txn(ctx).Then(ops...).Commit()
+		if err != nil {
+			return err
+		}
+		for _, r := range resp.Responses {
+			deleted += r.GetResponseDeleteRange().Deleted
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// chunk 把 n 個操作依照 MaxTxnOps 切段，依序交給 fn
+func (client *Client) chunk(n int, fn func(start, end int) error) error {
+	maxOps := client.maxTxnOps()
+	for start := 0; start < n; start += maxOps {
+		end := start + maxOps
+		if end > n {
+			end = n
+		}
+		if err := fn(start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (client *Client) maxTxnOps() int {
+	if client.config.MaxTxnOps > 0 {
+		return client.config.MaxTxnOps
+	}
+	return DefaultMaxTxnOps
+}
+
+type STMOption func(opts *stmOptions)
+
+type stmOptions struct {
+	isolation concurrency.Isolation
+	prefetch  []string
+}
+
+// WithIsolation 設定 STM 的隔離等級，預設為 concurrency.SerializableSnapshot
+func WithIsolation(isolation concurrency.Isolation) STMOption {
+	return func(opts *stmOptions) {
+		opts.isolation = isolation
+	}
+}
+
+// WithPrefetch 在第一次執行 apply 前先讀取這些 key
+func WithPrefetch(keys ...string) STMOption {
+	return func(opts *stmOptions) {
+		opts.prefetch = append(opts.prefetch, keys...)
+	}
+}
+
+// STM 以軟體交易記憶體的方式，對多個 key 做讀取、修改、寫回，
+// 讀取過的 key 在提交前被別人修改時，apply 會被重新執行，apply 內不應該有其他副作用
+func (client *Client) STM(ctx context.Context, apply func(stm concurrency.STM) error, options ...STMOption) (*clientv3.TxnResponse, error) {
+	opts := &stmOptions{isolation: concurrency.SerializableSnapshot}
+	for _, option := range options {
+		option(opts)
+	}
+	return concurrency.NewSTM(client.Client, apply,
+		concurrency.WithAbortContext(ctx),
+		concurrency.WithIsolation(opts.isolation),
+		concurrency.WithPrefetch(opts.prefetch...),
+	)
+}
@@ -0,0 +1,119 @@
+package etcdv3
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxnBuilder(t *testing.T) {
+	etcdCli := newTestClient(t)
+	ctx := context.Background()
+
+	resp, err := etcdCli.NewTxn(ctx).
+		If(KeyMissing("/test/txn/a")).
+		Then(clientv3.OpPut("/test/txn/a", "1"), clientv3.OpPut("/test/txn/b", "1")).
+		Commit()
+	assert.Nil(t, err)
+	assert.True(t, resp.Succeeded)
+
+	keyValue, err := etcdCli.GetKeyValue(ctx, "/test/txn/a")
+	assert.Nil(t, err)
+
+	// 條件可以分多次加入
+	resp, err = etcdCli.NewTxn(ctx).
+		If(ModRevisionEquals("/test/txn/a", keyValue.ModRevision)).
+		If(ValueEquals("/test/txn/a", "2")).
+		Then(clientv3.OpDelete("/test/txn/b")).
+		Else(clientv3.OpGet("/test/txn/b")).
+		Commit()
+	assert.Nil(t, err)
+	assert.False(t, resp.Succeeded)
+	assert.Equal(t, "1", string(resp.Responses[0].GetResponseRange().Kvs[0].Value))
+
+	resp, err = etcdCli.NewTxn(ctx).
+		If(KeyExists("/test/txn/a"), VersionEquals("/test/txn/a", 1)).
+		Then(clientv3.OpDelete("/test/txn/b")).
+		Commit()
+	assert.Nil(t, err)
+	assert.True(t, resp.Succeeded)
+}
+
+func TestTxnBuilder_TooManyOps(t *testing.T) {
+	etcdCli := newTestClient(t)
+	etcdCli.config.MaxTxnOps = 2
+
+	_, err := etcdCli.NewTxn(context.Background()).
+		Then(clientv3.OpGet("a"), clientv3.OpGet("b"), clientv3.OpGet("c")).
+		Commit()
+	assert.Equal(t, ErrTooManyTxnOps, err)
+}
+
+func TestBatch(t *testing.T) {
+	etcdCli := newTestClient(t)
+	etcdCli.config.MaxTxnOps = 8
+	ctx := context.Background()
+
+	kvs := make(map[string]string)
+	keys := make([]string, 0)
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("/test/batch/%02d", i)
+		kvs[key] = strconv.Itoa(i)
+		keys = append(keys, key)
+	}
+	assert.Nil(t, etcdCli.PutMany(ctx, kvs))
+
+	values, revision, err := etcdCli.GetMany(ctx, append(keys, "/test/batch/missing")...)
+	assert.Nil(t, err)
+	assert.Equal(t, kvs, values)
+	assert.NotZero(t, revision)
+
+	// 每次呼叫都重新取得最新的 revision
+	_, err = etcdCli.Put(ctx, keys[0], "changed")
+	assert.Nil(t, err)
+	values, _, err = etcdCli.GetMany(ctx, keys...)
+	assert.Nil(t, err)
+	assert.Equal(t, "changed", values[keys[0]])
+
+	deleted, err := etcdCli.DeleteMany(ctx, keys...)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(30), deleted)
+}
+
+func TestSTM(t *testing.T) {
+	etcdCli := newTestClient(t)
+	ctx := context.Background()
+	_, err := etcdCli.Put(ctx, "/test/stm/a", "100")
+	assert.Nil(t, err)
+	_, err = etcdCli.Put(ctx, "/test/stm/b", "0")
+	assert.Nil(t, err)
+
+	// 併發地從 a 轉移到 b，總和必須不變
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := etcdCli.STM(ctx, func(stm concurrency.STM) error {
+				a, _ := strconv.Atoi(stm.Get("/test/stm/a"))
+				b, _ := strconv.Atoi(stm.Get("/test/stm/b"))
+				stm.Put("/test/stm/a", strconv.Itoa(a-10))
+				stm.Put("/test/stm/b", strconv.Itoa(b+10))
+				return nil
+			}, WithPrefetch("/test/stm/a", "/test/stm/b"))
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	values, _, err := etcdCli.GetMany(ctx, "/test/stm/a", "/test/stm/b")
+	assert.Nil(t, err)
+	assert.Equal(t, "0", values["/test/stm/a"])
+	assert.Equal(t, "100", values["/test/stm/b"])
+}
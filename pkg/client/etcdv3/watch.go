@@ -3,6 +3,7 @@ package etcdv3
 import (
 	"context"
 	"github.com/digital-monster-1997/digicore/pkg/dlog"
+	"github.com/digital-monster-1997/digicore/pkg/ecode"
 	"sync"
 
 	"github.com/coreos/etcd/clientv3"
@@ -56,8 +57,7 @@ func (client *Client) WatchPrefix(ctx context.Context, prefix string) (*Watch, e
 					w.revision = n.Header.GetRevision()
 				}
 				if err := n.Err(); err != nil {
-					//dlog.Error(ecode.MsgWatchRequestErr, dlog.FieldErrKind(ecode.ErrKindRegisterErr), dlog.FieldErr(err), dlog.FieldAddr(prefix))
-					dlog.Error("", dlog.FieldErr(err), dlog.FieldAddr(prefix))
+					dlog.Error(ecode.MsgWatchRequestErr, dlog.FieldMod(ecode.ModClientETCD), dlog.FieldErrKind(ecode.ErrKindRegisterErr), dlog.FieldErr(err), dlog.FieldAddr(prefix))
 					continue
 				}
 				for _, ev := range n.Events {
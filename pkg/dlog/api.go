@@ -9,90 +9,97 @@ var DigitCore = Config{
 	CallerSkip: 0,
 }.Build()
 
+// defaultLogger 套件層級的函式使用的 logger，多跳過一層 caller
+func defaultLogger() *Logger {
+	if DigitCore.helper != nil {
+		return DigitCore.helper
+	}
+	return DigitCore
+}
 
 func Info(msg string, fields ...Field) {
-	DigitCore.Info(msg, fields...)
+	defaultLogger().Info(msg, fields...)
 }
 
 func Debug(msg string, fields ...Field) {
-	DigitCore.Debug(msg, fields...)
+	defaultLogger().Debug(msg, fields...)
 }
 
 func Warn(msg string, fields ...Field) {
-	DigitCore.Warn(msg, fields...)
+	defaultLogger().Warn(msg, fields...)
 }
 
 func Error(msg string, fields ...Field) {
-	DigitCore.Error(msg, fields...)
+	defaultLogger().Error(msg, fields...)
 }
 
 func Panic(msg string, fields ...Field) {
-	DigitCore.Panic(msg, fields...)
+	defaultLogger().Panic(msg, fields...)
 }
 
 func DPanic(msg string, fields ...Field) {
-	DigitCore.DPanic(msg, fields...)
+	defaultLogger().DPanic(msg, fields...)
 }
 
 func Fatal(msg string, fields ...Field) {
-	DigitCore.Fatal(msg, fields...)
+	defaultLogger().Fatal(msg, fields...)
 }
 
 func Debugw(msg string, keysAndValues ...interface{}) {
-	DigitCore.Debugw(msg, keysAndValues...)
+	defaultLogger().Debugw(msg, keysAndValues...)
 }
 
 func Infow(msg string, keysAndValues ...interface{}) {
-	DigitCore.Infow(msg, keysAndValues...)
+	defaultLogger().Infow(msg, keysAndValues...)
 }
 
 func Warnw(msg string, keysAndValues ...interface{}) {
-	DigitCore.Warnw(msg, keysAndValues...)
+	defaultLogger().Warnw(msg, keysAndValues...)
 }
 
 // Errorw ...
 func Errorw(msg string, keysAndValues ...interface{}) {
-	DigitCore.Errorw(msg, keysAndValues...)
+	defaultLogger().Errorw(msg, keysAndValues...)
 }
 
 func Panicw(msg string, keysAndValues ...interface{}) {
-	DigitCore.Panicw(msg, keysAndValues...)
+	defaultLogger().Panicw(msg, keysAndValues...)
 }
 
 func DPanicw(msg string, keysAndValues ...interface{}) {
-	DigitCore.DPanicw(msg, keysAndValues...)
+	defaultLogger().DPanicw(msg, keysAndValues...)
 }
 
 func Fatalw(msg string, keysAndValues ...interface{}) {
-	DigitCore.Fatalw(msg, keysAndValues...)
+	defaultLogger().Fatalw(msg, keysAndValues...)
 }
 
 func Debugf(msg string, args ...interface{}) {
-	DigitCore.Debugf(msg, args...)
+	defaultLogger().Debugf(msg, args...)
 }
 
 func Infof(msg string, args ...interface{}) {
-	DigitCore.Infof(msg, args...)
+	defaultLogger().Infof(msg, args...)
 }
 
 func Warnf(msg string, args ...interface{}) {
-	DigitCore.Warnf(msg, args...)
+	defaultLogger().Warnf(msg, args...)
 }
 
 func Errorf(msg string, args ...interface{}) {
-	DigitCore.Errorf(msg, args...)
+	defaultLogger().Errorf(msg, args...)
 }
 
 func Panicf(msg string, args ...interface{}) {
-	DigitCore.Panicf(msg, args...)
+	defaultLogger().Panicf(msg, args...)
 }
 
 func DPanicf(msg string, args ...interface{}) {
-	DigitCore.DPanicf(msg, args...)
+	defaultLogger().DPanicf(msg, args...)
 }
 
 func Fatalf(msg string, args ...interface{}) {
-	DigitCore.Fatalf(msg, args...)
+	defaultLogger().Fatalf(msg, args...)
 }
 
 func With(fields ...Field) *Logger {
@@ -0,0 +1,268 @@
+package dlog
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// OverflowBlock 緩衝滿了之後等待，不會遺失日誌
+	OverflowBlock = "block"
+	// OverflowDropOldest 緩衝滿了之後丟掉最舊的一筆
+	OverflowDropOldest = "drop_oldest"
+	// OverflowDropNewest 緩衝滿了之後丟掉正要寫入的這一筆
+	OverflowDropNewest = "drop_newest"
+
+	defaultAsyncBufferSize    = 4096
+	defaultAsyncBatchSize     = 128
+	defaultAsyncFlushInterval = 200 * time.Millisecond
+)
+
+// AsyncConfig 非同步輸出的設定，寫入時只放進緩衝，由背景的 goroutine 批次寫出，
+// Panic 以上的等級會先寫出緩衝再同步寫入
+type AsyncConfig struct {
+	// BufferSize 緩衝可以容納的筆數，預設 4096
+	BufferSize int
+	// BatchSize 緩衝累積到這個筆數時立刻寫出，預設 128
+	BatchSize int
+	// FlushInterval 沒有累積到 BatchSize 時，每隔多久寫出一次，預設 200ms
+	FlushInterval time.Duration
+	// Overflow 緩衝滿了之後的處理方式，block、drop_oldest 或 drop_newest，預設 block
+	Overflow string
+}
+
+func (config AsyncConfig) normalize() (AsyncConfig, error) {
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultAsyncBufferSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultAsyncBatchSize
+	}
+	if config.BatchSize > config.BufferSize {
+		config.BatchSize = config.BufferSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultAsyncFlushInterval
+	}
+	switch config.Overflow {
+	case "":
+		config.Overflow = OverflowBlock
+	case OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+	default:
+		return config, fmt.Errorf("dlog: unknown overflow policy %q", config.Overflow)
+	}
+	return config, nil
+}
+
+// asyncRecord 緩衝中的一筆日誌，core 是寫入時 With 過欄位的 core
+type asyncRecord struct {
+	core   zapcore.Core
+	entry  zapcore.Entry
+	fields []zapcore.Field
+}
+
+// asyncQueue 固定大小的環狀緩衝以及寫出的 goroutine
+type asyncQueue struct {
+	config  AsyncConfig
+	dropped *uint64
+
+	lock    sync.Mutex
+	notFull *sync.Cond
+	records []asyncRecord
+	head    int
+	size    int
+	closed  bool
+
+	wakeup  chan struct{}
+	flushes chan chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newAsyncQueue(config AsyncConfig, dropped *uint64) *asyncQueue {
+	queue := &asyncQueue{
+		config:  config,
+		dropped: dropped,
+		records: make([]asyncRecord, config.BufferSize),
+		wakeup:  make(chan struct{}, 1),
+		flushes: make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	queue.notFull = sync.NewCond(&queue.lock)
+	go queue.run()
+	return queue
+}
+
+// push 放進緩衝，關閉之後返回 false，由呼叫端直接寫入
+func (queue *asyncQueue) push(record asyncRecord) bool {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	capacity := len(queue.records)
+	for !queue.closed && queue.size == capacity {
+		switch queue.config.Overflow {
+		case OverflowDropNewest:
+			atomic.AddUint64(queue.dropped, 1)
+			return true
+		case OverflowDropOldest:
+			queue.records[queue.head] = asyncRecord{}
+			queue.head = (queue.head + 1) % capacity
+			queue.size--
+			atomic.AddUint64(queue.dropped, 1)
+		default:
+			queue.notify()
+			queue.notFull.Wait()
+		}
+	}
+	if queue.closed {
+		return false
+	}
+	queue.records[(queue.head+queue.size)%capacity] = record
+	queue.size++
+	if queue.size >= queue.config.BatchSize {
+		queue.notify()
+	}
+	return true
+}
+
+func (queue *asyncQueue) notify() {
+	select {
+	case queue.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// pop 取出最多 BatchSize 筆
+func (queue *asyncQueue) pop(batch []asyncRecord) []asyncRecord {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	capacity := len(queue.records)
+	for queue.size > 0 && len(batch) < queue.config.BatchSize {
+		batch = append(batch, queue.records[queue.head])
+		queue.records[queue.head] = asyncRecord{}
+		queue.head = (queue.head + 1) % capacity
+		queue.size--
+	}
+	queue.notFull.Broadcast()
+	return batch
+}
+
+func (queue *asyncQueue) run() {
+	defer close(queue.done)
+	ticker := time.NewTicker(queue.config.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]asyncRecord, 0, queue.config.BatchSize)
+	for {
+		select {
+		case <-queue.wakeup:
+		case <-ticker.C:
+		case flushed := <-queue.flushes:
+			batch = queue.drain(batch)
+			close(flushed)
+			continue
+		case <-queue.stop:
+			queue.drain(batch)
+			return
+		}
+		batch = queue.drain(batch)
+	}
+}
+
+// drain 寫出緩衝中所有的日誌
+func (queue *asyncQueue) drain(batch []asyncRecord) []asyncRecord {
+	for {
+		batch = queue.pop(batch[:0])
+		if len(batch) == 0 {
+			return batch
+		}
+		for i := range batch {
+			writeRecord(batch[i].core, batch[i].entry, batch[i].fields)
+			batch[i] = asyncRecord{}
+		}
+	}
+}
+
+// flush 等待緩衝中的日誌全部寫出
+func (queue *asyncQueue) flush() {
+	flushed := make(chan struct{})
+	select {
+	case queue.flushes <- flushed:
+		<-flushed
+	case <-queue.done:
+	}
+}
+
+// Close 寫出緩衝並停止背景的 goroutine
+func (queue *asyncQueue) Close() error {
+	queue.lock.Lock()
+	if queue.closed {
+		queue.lock.Unlock()
+		return nil
+	}
+	queue.closed = true
+	queue.notFull.Broadcast()
+	queue.lock.Unlock()
+
+	close(queue.stop)
+	<-queue.done
+	return nil
+}
+
+// writeRecord 經過 Check 再寫入，Tee 的 Write 不會檢查各個輸出的等級，取樣也是在 Check 時決定
+func writeRecord(core zapcore.Core, entry zapcore.Entry, fields []zapcore.Field) {
+	if checked := core.Check(entry, nil); checked != nil {
+		checked.Write(fields...)
+	}
+}
+
+// asyncCore 把日誌放進 asyncQueue，With 出來的 core 共用同一個 queue
+type asyncCore struct {
+	zapcore.Core
+	queue *asyncQueue
+}
+
+func (core *asyncCore) With(fields []zapcore.Field) zapcore.Core {
+	return &asyncCore{
+		Core:  core.Core.With(fields),
+		queue: core.queue,
+	}
+}
+
+func (core *asyncCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if core.Enabled(entry.Level) {
+		return checked.AddCore(entry, core)
+	}
+	return checked
+}
+
+func (core *asyncCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	// Panic、Fatal 之後程式可能就結束了，先把緩衝寫出再同步寫入
+	if entry.Level > zapcore.ErrorLevel {
+		core.queue.flush()
+		writeRecord(core.Core, entry, fields)
+		return core.Core.Sync()
+	}
+	record := asyncRecord{
+		core:   core.Core,
+		entry:  entry,
+		fields: append([]zapcore.Field(nil), fields...),
+	}
+	if !core.queue.push(record) {
+		writeRecord(core.Core, entry, fields)
+	}
+	return nil
+}
+
+func (core *asyncCore) Sync() error {
+	core.queue.flush()
+	return core.Core.Sync()
+}
+
+// Dropped 因為非同步緩衝已滿而丟棄的日誌數量
+func (logger *Logger) Dropped() uint64 {
+	return atomic.LoadUint64(logger.state.dropped)
+}
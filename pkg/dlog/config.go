@@ -1,21 +1,47 @@
 package dlog
 
 import (
+	"io"
+	"time"
+
 	"github.com/digital-monster-1997/digicore/pkg/config"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"os"
 )
 
 type Config struct {
 	Level 		string
+	// Fields 每一筆日誌都會帶上的欄位
 	Fields 		[]zap.Field
 	AddCaller 	bool
+	// Prefix 作為 logger 的名稱輸出在 logger 欄位
 	Prefix 		string
 	Core        zapcore.Core
 	Debug       bool
 	CallerSkip   int
 	EncoderConfig *zapcore.EncoderConfig
+	// Outputs 輸出目的地，可以同時輸出到多個地方，空的時候只輸出到 stdout，設定了 Core 時不使用
+	Outputs 	[]OutputConfig
+	// ModuleLevels 依照 mod 欄位個別設定等級，例如 client.etcd = "debug"
+	ModuleLevels map[string]string
+	// Async 非同步輸出的設定，空的時候同步寫入
+	Async *AsyncConfig
+	// Sampling 取樣的設定，空的時候不取樣
+	Sampling *SamplingConfig
+	// ExitFunc Fatal 寫入並 Sync 之後呼叫，空的時候使用 os.Exit，測試時可以替換
+	ExitFunc func(code int)
+	// Dedup 在這段時間內連續重複的日誌合併成一筆 message repeated N times，0 表示不合併
+	Dedup time.Duration
+	// RedactKeys 欄位名稱符合時以 RedactMask 遮蔽，也套用在 Any、Reflect、Object 輸出的巢狀欄位，
+	// 支援 * 萬用字元且不分大小寫，空的時候使用 DefaultRedactKeys，標記 log:"secret" 的結構欄位一律遮蔽
+	RedactKeys []string
+	// RedactMask 遮蔽之後輸出的內容，預設 ******
+	RedactMask string
+	// DisableRedact 關閉遮蔽
+	DisableRedact bool
+	// Hooks 每一筆日誌都會交給 Hook，例如 SyslogSink、HTTPSink、SentrySink，
+	// 重新設定與 Close 時不會關閉，需要自行 Close
+	Hooks []Hook
 }
 
 // RawConfig  讀取 Config 當中的資料
@@ -26,16 +52,43 @@ func RawConfig(key string, config *Config, cfg *config.Configuration) *Config {
 	return config
 }
 
+// Bind 在設定檔熱加載時，以 key 底下的內容重新設定 logger，
+// 可以調整 Level、ModuleLevels、Outputs 與 Sampling，EncoderConfig 與沒有設定的 Sampling 會回到預設值
+func (logger *Logger) Bind(key string, cfg *config.Configuration) {
+	cfg.RegisterOnChangeFunctions(func(configuration *config.Configuration) {
+		if err := logger.reload(key, configuration); err != nil {
+			logger.Error("dlog reload config", FieldErr(err), FieldKey(key))
+		}
+	})
+}
+
+func (logger *Logger) reload(key string, cfg *config.Configuration) error {
+	conf := logger.state.currentConfig()
+	conf.Outputs = nil
+	conf.ModuleLevels = nil
+	conf.EncoderConfig = nil
+	conf.Sampling = nil
+	if err := cfg.ReadToStruct(key, &conf); err != nil {
+		return err
+	}
+	return logger.Reconfigure(conf)
+}
+
 // Build ...
 func (config Config) Build() *Logger {
+	config.normalize()
+	logger := newLogger(&config)
+	return logger
+}
+
+// normalize 補上預設的 EncoderConfig
+func (config *Config) normalize() {
 	if config.EncoderConfig == nil {
 		config.EncoderConfig = DefaultZapConfig()
 	}
 	if config.Debug {
 		config.EncoderConfig.EncodeLevel = DebugEncodeLevel
 	}
-	logger := newLogger(&config)
-	return logger
 }
 
 // DefaultZapConfig ...
@@ -57,44 +110,127 @@ func DefaultZapConfig() *zapcore.EncoderConfig {
 
 func newLogger(config *Config) *Logger {
 	zapOptions := make([]zap.Option, 0)
-	zapOptions = append(zapOptions, zap.AddStacktrace(zap.DPanicLevel))
+	// Fatal 寫入之後改成 panic，由 Logger.exit 攔下來呼叫 ExitFunc
+	zapOptions = append(zapOptions, zap.AddStacktrace(zap.DPanicLevel), zap.OnFatal(zapcore.WriteThenPanic))
 	if config.AddCaller {
-		zapOptions = append(zapOptions, zap.AddCaller(), zap.AddCallerSkip(config.CallerSkip))
+		// 多跳過一層 Logger 自己的方法
+		zapOptions = append(zapOptions, zap.AddCaller(), zap.AddCallerSkip(1+config.CallerSkip))
 	}
 	if len(config.Fields) > 0 {
 		zapOptions = append(zapOptions, zap.Fields(config.Fields...))
 	}
-	var ws zapcore.WriteSyncer
-	ws = os.Stdout
-
 	lv := zap.NewAtomicLevelAt(zapcore.InfoLevel)
 	if err := lv.UnmarshalText([]byte(config.Level)); err != nil {
 		panic(err)
 	}
+	modules, err := parseModuleLevels(config.ModuleLevels)
+	if err != nil {
+		panic(err)
+	}
+	dropped := new(uint64)
+	gen, err := config.buildGeneration(dropped)
+	if err != nil {
+		panic(err)
+	}
 
-	encoderConfig := *config.EncoderConfig
-	core := config.Core
-	if core == nil {
-		core = zapcore.NewCore(
-			func() zapcore.Encoder {
-				if config.Debug {
-					return zapcore.NewConsoleEncoder(encoderConfig)
-				}
-				return zapcore.NewJSONEncoder(encoderConfig)
-			}(),
-			ws,
-			lv,
-		)
+	levels := newLevelRegistry(lv)
+	levels.replaceModules(modules)
+	state := &loggerState{
+		levels:  levels,
+		holder:  newCoreHolder(gen),
+		config:  *config,
+		dropped: dropped,
+	}
+	core := &levelCore{
+		Core:   newDynamicCore(state.holder),
+		levels: levels,
 	}
 
 	zapLogger := zap.New(
 		core,
 		zapOptions...,
 	)
-	return &Logger{
+	if config.Prefix != "" {
+		zapLogger = zapLogger.Named(config.Prefix)
+	}
+	logger := &Logger{
 		desugar: zapLogger,
-		lv:      &lv,
+		lv:      &levels.lv,
 		config:  *config,
 		sugar:   zapLogger.Sugar(),
+		state:   state,
+	}
+	helperLogger := zapLogger.WithOptions(zap.AddCallerSkip(1))
+	logger.helper = &Logger{
+		desugar: helperLogger,
+		lv:      logger.lv,
+		config:  logger.config,
+		sugar:   helperLogger.Sugar(),
+		state:   state,
+	}
+	return logger
+}
+
+// buildGeneration 依照 Outputs 建立輸出，設定了 Core 時直接使用，
+// 之後依序加上 Hooks，包上非同步、取樣、合併重複日誌以及遮蔽
+func (config *Config) buildGeneration(dropped *uint64) (*generation, error) {
+	gen, err := config.buildOutputs()
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Hooks) > 0 {
+		gen.core = zapcore.NewTee(gen.core, newHookCore(config.Hooks))
+	}
+	if config.Async != nil {
+		asyncConfig, err := config.Async.normalize()
+		if err != nil {
+			_ = gen.closeAll()
+			return nil, err
+		}
+		queue := newAsyncQueue(asyncConfig, dropped)
+		gen.core = &asyncCore{Core: gen.core, queue: queue}
+		// 先寫出緩衝再關閉檔案
+		gen.closers = append([]io.Closer{queue}, gen.closers...)
+	}
+	if config.Sampling != nil {
+		gen.core = config.Sampling.wrap(gen.core)
+	}
+	if config.Dedup > 0 {
+		gen.core = newDedupCore(gen.core, config.Dedup)
+	}
+	if !config.DisableRedact {
+		redactor, err := newRedactor(config)
+		if err != nil {
+			_ = gen.close()
+			return nil, err
+		}
+		gen.core = &redactCore{Core: gen.core, redactor: redactor}
+		gen.redactor = redactor
+	}
+	return gen, nil
+}
+
+func (config *Config) buildOutputs() (*generation, error) {
+	if config.Core != nil {
+		return &generation{core: config.Core}, nil
+	}
+	outputs := config.Outputs
+	if len(outputs) == 0 {
+		outputs = []OutputConfig{{Type: OutputStdout}}
+	}
+	gen := &generation{}
+	cores := make([]zapcore.Core, 0, len(outputs))
+	for _, output := range outputs {
+		core, closer, err := output.build(config)
+		if err != nil {
+			_ = gen.closeAll()
+			return nil, err
+		}
+		cores = append(cores, core)
+		if closer != nil {
+			gen.closers = append(gen.closers, closer)
+		}
 	}
+	gen.core = zapcore.NewTee(cores...)
+	return gen, nil
 }
@@ -0,0 +1,148 @@
+package dlog
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	// KeyTraceID trace id 的欄位名稱
+	KeyTraceID = "trace_id"
+	// KeySpanID span id 的欄位名稱
+	KeySpanID = "span_id"
+	// KeyRequestID request id 的欄位名稱
+	KeyRequestID = "request_id"
+	// KeyUserID user id 的欄位名稱
+	KeyUserID = "user_id"
+)
+
+type loggerCtxKey struct{}
+
+// ctxIDKey context 中各種 id 的 key，欄位名稱相同
+type ctxIDKey string
+
+// contextKeys Ctx 依序取出的 id
+var contextKeys = []string{KeyTraceID, KeySpanID, KeyRequestID, KeyUserID}
+
+// ContextExtractor 從 context 中取出額外的欄位，例如從 tracing 套件的 span 取出 trace id
+type ContextExtractor func(ctx context.Context) []Field
+
+var (
+	extractorLock sync.RWMutex
+	extractors    []ContextExtractor
+)
+
+// RegisterContextExtractor 註冊 ContextExtractor，Ctx 時會依註冊順序附加欄位
+func RegisterContextExtractor(extractor ContextExtractor) {
+	extractorLock.Lock()
+	defer extractorLock.Unlock()
+	extractors = append(extractors, extractor)
+}
+
+// NewContext 把 logger 放進 context，之後 WithContext 或 FromContext 會取出這個 logger
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, logger)
+}
+
+// FromContext 取出 NewContext 放進去的 logger，沒有的時候返回 DigitCore
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerCtxKey{}).(*Logger); ok && logger != nil {
+			return logger
+		}
+	}
+	return DigitCore
+}
+
+// WithContext 取出 context 中的 logger，並附加 context 中的 trace id、span id、request id 與 user id
+func WithContext(ctx context.Context) *Logger {
+	return FromContext(ctx).Ctx(ctx)
+}
+
+// Ctx 附加 context 中的 trace id、span id、request id、user id 以及 ContextExtractor 的欄位，
+// 已經附加過相同值的 id 不會重複附加
+func (logger *Logger) Ctx(ctx context.Context) *Logger {
+	if ctx == nil {
+		return logger
+	}
+	var fields []Field
+	var ids map[string]string
+	for _, key := range contextKeys {
+		value := contextID(ctx, key)
+		if value == "" || logger.ctxIDs[key] == value {
+			continue
+		}
+		if ids == nil {
+			ids = make(map[string]string, len(logger.ctxIDs)+len(contextKeys))
+			for k, v := range logger.ctxIDs {
+				ids[k] = v
+			}
+		}
+		ids[key] = value
+		fields = append(fields, String(key, value))
+	}
+
+	extractorLock.RLock()
+	for _, extractor := range extractors {
+		fields = append(fields, extractor(ctx)...)
+	}
+	extractorLock.RUnlock()
+
+	if len(fields) == 0 {
+		return logger
+	}
+	child := logger.With(fields...)
+	if ids != nil {
+		child.ctxIDs = ids
+	}
+	return child
+}
+
+func contextWithID(ctx context.Context, key, value string) context.Context {
+	return context.WithValue(ctx, ctxIDKey(key), value)
+}
+
+func contextID(ctx context.Context, key string) string {
+	value, _ := ctx.Value(ctxIDKey(key)).(string)
+	return value
+}
+
+// ContextWithTraceID 由 middleware 放入 trace id
+func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	return contextWithID(ctx, KeyTraceID, traceID)
+}
+
+// ContextWithSpanID 由 middleware 放入 span id
+func ContextWithSpanID(ctx context.Context, spanID string) context.Context {
+	return contextWithID(ctx, KeySpanID, spanID)
+}
+
+// ContextWithRequestID 由 middleware 放入 request id
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return contextWithID(ctx, KeyRequestID, requestID)
+}
+
+// ContextWithUserID 由 middleware 放入 user id
+func ContextWithUserID(ctx context.Context, userID string) context.Context {
+	return contextWithID(ctx, KeyUserID, userID)
+}
+
+// TraceIDFromContext ...
+func TraceIDFromContext(ctx context.Context) string {
+	return contextID(ctx, KeyTraceID)
+}
+
+// SpanIDFromContext ...
+func SpanIDFromContext(ctx context.Context) string {
+	return contextID(ctx, KeySpanID)
+}
+
+// RequestIDFromContext ...
+func RequestIDFromContext(ctx context.Context) string {
+	return contextID(ctx, KeyRequestID)
+}
+
+// UserIDFromContext ...
+func UserIDFromContext(ctx context.Context) string {
+	return contextID(ctx, KeyUserID)
+}
@@ -0,0 +1,173 @@
+package dlog
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// levelCore 依照 levelRegistry 決定是否輸出，With 時記下 mod 欄位，
+// 有設定 mod 等級時，呼叫時帶的 mod 欄位（例如 Error(msg, FieldMod("file datasource"))）在 Write 時判斷
+type levelCore struct {
+	zapcore.Core
+	levels *levelRegistry
+	mod    string
+}
+
+// Enabled 有設定 mod 等級時，只要有任何 mod 會輸出就返回 true，留到 Write 時再依照呼叫時的 mod 判斷
+func (core *levelCore) Enabled(level zapcore.Level) bool {
+	if core.levels.enabled(core.mod, level) {
+		return true
+	}
+	return core.levels.anyEnabled(level)
+}
+
+func (core *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{
+		Core:   core.Core.With(fields),
+		levels: core.levels,
+		mod:    fieldsMod(core.mod, fields),
+	}
+}
+
+func (core *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !core.levels.hasModules() {
+		if !core.levels.enabled(core.mod, entry.Level) {
+			return checked
+		}
+		return core.Core.Check(entry, checked)
+	}
+	// 呼叫時的欄位要到 Write 才拿得到
+	if core.Enabled(entry.Level) {
+		return checked.AddCore(entry, core)
+	}
+	return checked
+}
+
+// Write 以呼叫時最後一個 mod 欄位判斷等級，沒有時使用 With 的 mod
+func (core *levelCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if core.levels.enabled(fieldsMod(core.mod, fields), entry.Level) {
+		writeRecord(core.Core, entry, fields)
+	}
+	return nil
+}
+
+// fieldsMod 返回 fields 中最後一個 mod 欄位，沒有時返回 mod
+func fieldsMod(mod string, fields []zapcore.Field) string {
+	for _, field := range fields {
+		if field.Key == "mod" && field.Type == zapcore.StringType {
+			mod = field.String
+		}
+	}
+	return mod
+}
+
+// generation 一組由設定建立出來的輸出，重新設定時整組替換
+type generation struct {
+	core    zapcore.Core
+	closers []io.Closer
+	// redactor DisableRedact 時為 nil，Debug 模式輸出 panic 詳情時也要遮蔽
+	redactor *redactor
+}
+
+// close 寫出緩衝並關閉輸出
+func (gen *generation) close() error {
+	err := gen.core.Sync()
+	if closeErr := gen.closeAll(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (gen *generation) closeAll() error {
+	var err error
+	for _, closer := range gen.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	gen.closers = nil
+	return err
+}
+
+// coreHolder 持有目前的 generation，所有 With 出來的 dynamicCore 共用
+type coreHolder struct {
+	value atomic.Value
+}
+
+func newCoreHolder(gen *generation) *coreHolder {
+	holder := &coreHolder{}
+	holder.value.Store(gen)
+	return holder
+}
+
+func (holder *coreHolder) load() *generation {
+	return holder.value.Load().(*generation)
+}
+
+// swap 換上新的 generation，舊的稍後再關閉，讓正在寫入的日誌可以完成
+func (holder *coreHolder) swap(gen *generation) {
+	old := holder.load()
+	holder.value.Store(gen)
+	time.AfterFunc(time.Second, func() {
+		_ = old.close()
+	})
+}
+
+// dynamicCore 把 With 的欄位記下來，套用在目前的 generation 上，
+// generation 被替換之後下一次寫入時重新套用
+type dynamicCore struct {
+	holder *coreHolder
+	fields []zapcore.Field
+	cache  atomic.Value
+}
+
+type cachedCore struct {
+	gen  *generation
+	core zapcore.Core
+}
+
+func newDynamicCore(holder *coreHolder) *dynamicCore {
+	return &dynamicCore{holder: holder}
+}
+
+func (core *dynamicCore) current() zapcore.Core {
+	gen := core.holder.load()
+	if cached, ok := core.cache.Load().(*cachedCore); ok && cached.gen == gen {
+		return cached.core
+	}
+	current := gen.core
+	if len(core.fields) > 0 {
+		current = current.With(core.fields)
+	}
+	core.cache.Store(&cachedCore{gen: gen, core: current})
+	return current
+}
+
+func (core *dynamicCore) Enabled(level zapcore.Level) bool {
+	return core.current().Enabled(level)
+}
+
+func (core *dynamicCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &dynamicCore{
+		holder: core.holder,
+		fields: make([]zapcore.Field, 0, len(core.fields)+len(fields)),
+	}
+	clone.fields = append(clone.fields, core.fields...)
+	clone.fields = append(clone.fields, fields...)
+	return clone
+}
+
+func (core *dynamicCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return core.current().Check(entry, checked)
+}
+
+func (core *dynamicCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return core.current().Write(entry, fields)
+}
+
+func (core *dynamicCore) Sync() error {
+	return core.current().Sync()
+}
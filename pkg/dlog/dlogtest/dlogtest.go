@@ -0,0 +1,235 @@
+// Package dlogtest 提供寫入記憶體的 dlog.Logger，讓測試可以檢查輸出的日誌
+package dlogtest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/digital-monster-1997/digicore/pkg/dlog"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// Entry 一筆記錄下來的日誌，Context 包含 With 與呼叫時的欄位
+type Entry = observer.LoggedEntry
+
+// Option 調整測試用 logger 的設定
+type Option func(config *dlog.Config)
+
+// WithLevel 設定等級，預設為 debug
+func WithLevel(level dlog.Level) Option {
+	return func(config *dlog.Config) {
+		config.Level = level.String()
+	}
+}
+
+// WithConfig 直接調整 dlog.Config，例如設定 Prefix 或 RedactKeys，Core 會被覆蓋
+func WithConfig(fn func(config *dlog.Config)) Option {
+	return fn
+}
+
+// New 建立寫入記憶體的 logger，經過與一般 logger 相同的等級、遮蔽等處理，
+// Fatal 不會結束程式
+func New(opts ...Option) (*dlog.Logger, *Logs) {
+	config := dlog.Config{
+		Level:    "debug",
+		ExitFunc: func(code int) {},
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	core, observed := observer.New(zapcore.DebugLevel)
+	config.Core = core
+	return config.Build(), &Logs{observed: observed}
+}
+
+// globalLock 保護 dlog.DigitCore 的替換與還原
+var globalLock sync.Mutex
+
+// ReplaceGlobal 在測試期間把 dlog.DigitCore 換成 logger，測試結束時換回來，
+// 可以巢狀呼叫（例如子測試再替換一次），Cleanup 會依照相反的順序還原，
+// 替換本身有 lock 保護，但讀取 dlog.DigitCore 的程式沒有同步，不能在 t.Parallel() 的測試中使用，
+// 還原時發現 dlog.DigitCore 被其他測試換掉會回報錯誤
+func ReplaceGlobal(t testing.TB, logger *dlog.Logger) {
+	t.Helper()
+	globalLock.Lock()
+	original := dlog.DigitCore
+	dlog.DigitCore = logger
+	globalLock.Unlock()
+	t.Cleanup(func() {
+		globalLock.Lock()
+		defer globalLock.Unlock()
+		if dlog.DigitCore != logger {
+			t.Errorf("dlogtest: dlog.DigitCore was replaced by another test without restoring, ReplaceGlobal does not support t.Parallel()")
+		}
+		dlog.DigitCore = original
+	})
+}
+
+// NewGlobal 建立寫入記憶體的 logger 並替換 dlog.DigitCore，與 ReplaceGlobal 相同可以巢狀呼叫，不能在 t.Parallel() 的測試中使用
+func NewGlobal(t testing.TB, opts ...Option) *Logs {
+	t.Helper()
+	logger, logs := New(opts...)
+	ReplaceGlobal(t, logger)
+	return logs
+}
+
+// Logs 記錄下來的日誌，Filter 開頭的方法返回符合條件的子集合
+type Logs struct {
+	observed *observer.ObservedLogs
+	// filtered 為 true 時 entries 是過濾之後的結果
+	entries  []Entry
+	filtered bool
+}
+
+func (logs *Logs) filter(fn func(entry Entry) bool) *Logs {
+	filtered := make([]Entry, 0)
+	for _, entry := range logs.All() {
+		if fn(entry) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return &Logs{entries: filtered, filtered: true}
+}
+
+// All 所有的日誌，依照寫入的順序
+func (logs *Logs) All() []Entry {
+	if logs.filtered {
+		return append([]Entry(nil), logs.entries...)
+	}
+	return logs.observed.All()
+}
+
+// Len ...
+func (logs *Logs) Len() int {
+	if logs.filtered {
+		return len(logs.entries)
+	}
+	return logs.observed.Len()
+}
+
+// Messages 所有日誌的訊息
+func (logs *Logs) Messages() []string {
+	entries := logs.All()
+	messages := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		messages = append(messages, strings.TrimSpace(entry.Message))
+	}
+	return messages
+}
+
+// TakeAll 取出並清空所有的日誌，只能在 New 返回的 Logs 上使用
+func (logs *Logs) TakeAll() []Entry {
+	if logs.filtered {
+		panic("dlogtest: TakeAll on filtered logs")
+	}
+	return logs.observed.TakeAll()
+}
+
+// FilterLevel 等級相同的日誌
+func (logs *Logs) FilterLevel(level dlog.Level) *Logs {
+	return logs.filter(func(entry Entry) bool {
+		return entry.Level == level
+	})
+}
+
+// FilterMessage 訊息相同的日誌，Debug 模式補上的空白會被忽略
+func (logs *Logs) FilterMessage(msg string) *Logs {
+	return logs.filter(func(entry Entry) bool {
+		return strings.TrimSpace(entry.Message) == msg
+	})
+}
+
+// FilterMessageSnippet 訊息包含 snippet 的日誌
+func (logs *Logs) FilterMessageSnippet(snippet string) *Logs {
+	return logs.filter(func(entry Entry) bool {
+		return strings.Contains(entry.Message, snippet)
+	})
+}
+
+// FilterFieldKey 帶有 key 欄位的日誌
+func (logs *Logs) FilterFieldKey(key string) *Logs {
+	return logs.filter(func(entry Entry) bool {
+		_, ok := entry.ContextMap()[key]
+		return ok
+	})
+}
+
+// FilterField 帶有相同欄位的日誌
+func (logs *Logs) FilterField(field dlog.Field) *Logs {
+	expected := encodeFields([]dlog.Field{field})
+	return logs.filter(func(entry Entry) bool {
+		return containsFields(entry, expected)
+	})
+}
+
+// FilterMod 指定 mod 的日誌
+func (logs *Logs) FilterMod(mod string) *Logs {
+	return logs.FilterField(dlog.FieldMod(mod))
+}
+
+// AssertLogged 至少有一筆等級與訊息相同，並帶有所有 fields 的日誌
+func (logs *Logs) AssertLogged(t testing.TB, level dlog.Level, msg string, fields ...dlog.Field) bool {
+	t.Helper()
+	expected := encodeFields(fields)
+	for _, entry := range logs.FilterLevel(level).FilterMessage(msg).All() {
+		if containsFields(entry, expected) {
+			return true
+		}
+	}
+	t.Errorf("dlogtest: no %s log %q with fields %v, got:\n%s", level, msg, expected, logs)
+	return false
+}
+
+// AssertNotLogged 沒有等級與訊息相同的日誌
+func (logs *Logs) AssertNotLogged(t testing.TB, level dlog.Level, msg string) bool {
+	t.Helper()
+	if logs.FilterLevel(level).FilterMessage(msg).Len() > 0 {
+		t.Errorf("dlogtest: unexpected %s log %q, got:\n%s", level, msg, logs)
+		return false
+	}
+	return true
+}
+
+// AssertCount 日誌的數量
+func (logs *Logs) AssertCount(t testing.TB, count int) bool {
+	t.Helper()
+	if logs.Len() != count {
+		t.Errorf("dlogtest: expected %d logs, got %d:\n%s", count, logs.Len(), logs)
+		return false
+	}
+	return true
+}
+
+// String 每行一筆，方便在測試失敗時輸出
+func (logs *Logs) String() string {
+	var builder strings.Builder
+	for _, entry := range logs.All() {
+		fmt.Fprintf(&builder, "\t%s %s %v\n", entry.Level, strings.TrimSpace(entry.Message), entry.ContextMap())
+	}
+	return builder.String()
+}
+
+func encodeFields(fields []dlog.Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	return enc.Fields
+}
+
+func containsFields(entry Entry, expected map[string]interface{}) bool {
+	if len(expected) == 0 {
+		return true
+	}
+	actual := entry.ContextMap()
+	for key, value := range expected {
+		if !reflect.DeepEqual(actual[key], value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package dlogtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/digital-monster-1997/digicore/pkg/dlog"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTB 記錄 Errorf 的 testing.TB，用來測試斷言失敗的情況，其他方法沒有實作
+type fakeTB struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (t *fakeTB) Helper() {}
+
+func (t *fakeTB) Cleanup(fn func()) {
+	t.cleanups = append(t.cleanups, fn)
+}
+
+// cleanup 與 testing 相同依照相反的順序執行
+func (t *fakeTB) cleanup() {
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		t.cleanups[i]()
+	}
+}
+
+func (t *fakeTB) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeTB) Failed() bool {
+	return len(t.errors) > 0
+}
+
+func Test_New(t *testing.T) {
+	logger, logs := New(WithLevel(dlog.InfoLevel), WithConfig(func(config *dlog.Config) {
+		config.Prefix = "test"
+	}))
+
+	logger.Debug("ignored")
+	logger.With(dlog.FieldMod("client.etcd")).Info("connected", dlog.FieldAddr("127.0.0.1:2379"))
+	logger.Warn("slow request", dlog.FieldKey("/a"), dlog.String("password", "p"))
+	logger.Fatal("exit")
+
+	logs.AssertCount(t, 3)
+	logs.AssertLogged(t, dlog.InfoLevel, "connected", dlog.FieldAddr("127.0.0.1:2379"))
+	logs.AssertLogged(t, dlog.WarnLevel, "slow request", dlog.String("password", dlog.DefaultRedactMask))
+	logs.AssertNotLogged(t, dlog.DebugLevel, "ignored")
+
+	assert.Equal(t, []string{"connected"}, logs.FilterMod("client.etcd").Messages())
+	assert.Equal(t, 1, logs.FilterFieldKey("key").Len())
+	assert.Equal(t, 1, logs.FilterLevel(dlog.FatalLevel).Len())
+	assert.Equal(t, 1, logs.FilterMessageSnippet("slow").Len())
+	assert.Equal(t, "test", logs.All()[0].LoggerName)
+
+	fake := &fakeTB{}
+	assert.False(t, logs.AssertLogged(fake, dlog.InfoLevel, "connected", dlog.FieldAddr("other")))
+	assert.True(t, fake.Failed())
+	assert.Contains(t, fake.errors[0], "connected")
+
+	assert.Equal(t, 3, len(logs.TakeAll()))
+	assert.Equal(t, 0, logs.Len())
+}
+
+func Test_ReplaceGlobal(t *testing.T) {
+	original := dlog.DigitCore
+	t.Run("replace", func(t *testing.T) {
+		logs := NewGlobal(t)
+		dlog.Info("global message", dlog.FieldName("n"))
+		dlog.WithContext(dlog.ContextWithRequestID(context.Background(), "req")).Warn("with context")
+
+		logs.AssertLogged(t, dlog.InfoLevel, "global message", dlog.FieldName("n"))
+		logs.AssertLogged(t, dlog.WarnLevel, "with context", dlog.String(dlog.KeyRequestID, "req"))
+
+		// 巢狀替換，子測試結束之後換回外層的 logger
+		t.Run("nested", func(t *testing.T) {
+			inner := NewGlobal(t)
+			dlog.Info("inner message")
+			inner.AssertLogged(t, dlog.InfoLevel, "inner message")
+		})
+		dlog.Info("outer message")
+		logs.AssertLogged(t, dlog.InfoLevel, "outer message")
+		logs.AssertNotLogged(t, dlog.InfoLevel, "inner message")
+	})
+	assert.Equal(t, original, dlog.DigitCore)
+
+	// 還原時 dlog.DigitCore 已經被別人換掉，回報錯誤並且仍然還原
+	fake := &fakeTB{}
+	logger, _ := New()
+	ReplaceGlobal(fake, logger)
+	dlog.DigitCore, _ = New()
+	fake.cleanup()
+	assert.True(t, fake.Failed())
+	assert.Contains(t, fake.errors[0], "t.Parallel()")
+	assert.Equal(t, original, dlog.DigitCore)
+}
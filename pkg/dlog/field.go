@@ -1,8 +1,10 @@
 package dlog
 
 import (
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"strings"
 	"time"
 )
@@ -60,8 +62,38 @@ func FieldErrKind(value string) Field {
 	return String("errKind", value)
 }
 
+// FieldErr 一般的錯誤輸出在 error 欄位，帶有 Code()、Kind() 的錯誤（例如 ecode.Error）
+// 另外輸出 code、errKind、errMod 與 errStack
 func FieldErr(err error) Field {
-	return zap.Error(err)
+	if err == nil {
+		return zap.Error(err)
+	}
+	var coded interface{ Code() int32 }
+	if !errors.As(err, &coded) {
+		return zap.Error(err)
+	}
+	return zap.Inline(codedError{err: err, coded: coded})
+}
+
+// codedError 把錯誤的 code、種類與堆疊攤平成欄位
+type codedError struct {
+	err   error
+	coded interface{ Code() int32 }
+}
+
+func (e codedError) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("error", e.err.Error())
+	enc.AddInt32("code", e.coded.Code())
+	if kind, ok := e.coded.(interface{ Kind() string }); ok && kind.Kind() != "" {
+		enc.AddString("errKind", kind.Kind())
+	}
+	if mod, ok := e.coded.(interface{ Mod() string }); ok && mod.Mod() != "" {
+		enc.AddString("errMod", mod.Mod())
+	}
+	if stack, ok := e.coded.(interface{ Stack() string }); ok {
+		enc.AddString("errStack", stack.Stack())
+	}
+	return nil
 }
 
 func FieldStringErr(err string) Field {
@@ -0,0 +1,344 @@
+package dlog
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// ErrSinkClosed sink 已經關閉
+var ErrSinkClosed = errors.New("dlog: sink closed")
+
+// HookEntry 傳給 Hook 的一筆日誌
+type HookEntry struct {
+	Level   Level                  `json:"level"`
+	Time    time.Time              `json:"ts"`
+	Logger  string                 `json:"logger,omitempty"`
+	Message string                 `json:"msg"`
+	Caller  string                 `json:"caller,omitempty"`
+	Stack   string                 `json:"stack,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Hook 每一筆日誌都會呼叫 Fire，Enabled 決定要接收哪些等級，
+// Fire 在寫日誌的 goroutine 上執行，耗時的工作應該放進緩衝之後再處理，
+// 實作 Sync() error 的 Hook 會在 logger Sync 或 Close 時被呼叫
+type Hook interface {
+	Enabled(level Level) bool
+	Fire(entry HookEntry) error
+}
+
+// HookFunc 接收所有等級的 Hook
+type HookFunc func(entry HookEntry) error
+
+// Enabled ...
+func (fn HookFunc) Enabled(level Level) bool {
+	return true
+}
+
+// Fire ...
+func (fn HookFunc) Fire(entry HookEntry) error {
+	return fn(entry)
+}
+
+// LevelHook 只接收 level 以上的日誌
+func LevelHook(level Level, hook Hook) Hook {
+	return levelHook{Hook: hook, level: level}
+}
+
+type levelHook struct {
+	Hook
+	level Level
+}
+
+func (hook levelHook) Enabled(level Level) bool {
+	return level >= hook.level && hook.Hook.Enabled(level)
+}
+
+func (hook levelHook) Sync() error {
+	if syncer, ok := hook.Hook.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+// hookCore 把日誌轉成 HookEntry 交給 Hook
+type hookCore struct {
+	hooks  []Hook
+	fields []zapcore.Field
+}
+
+func newHookCore(hooks []Hook) *hookCore {
+	return &hookCore{hooks: hooks}
+}
+
+func (core *hookCore) Enabled(level zapcore.Level) bool {
+	for _, hook := range core.hooks {
+		if hook.Enabled(level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (core *hookCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &hookCore{
+		hooks:  core.hooks,
+		fields: make([]zapcore.Field, 0, len(core.fields)+len(fields)),
+	}
+	clone.fields = append(clone.fields, core.fields...)
+	clone.fields = append(clone.fields, fields...)
+	return clone
+}
+
+func (core *hookCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if core.Enabled(entry.Level) {
+		return checked.AddCore(entry, core)
+	}
+	return checked
+}
+
+func (core *hookCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range core.fields {
+		field.AddTo(enc)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	hookEntry := HookEntry{
+		Level:   entry.Level,
+		Time:    entry.Time,
+		Logger:  entry.LoggerName,
+		Message: entry.Message,
+		Stack:   entry.Stack,
+		Fields:  enc.Fields,
+	}
+	if entry.Caller.Defined {
+		hookEntry.Caller = entry.Caller.TrimmedPath()
+	}
+	for _, hook := range core.hooks {
+		if !hook.Enabled(entry.Level) {
+			continue
+		}
+		if err := hook.Fire(hookEntry); err != nil {
+			fmt.Fprintf(os.Stderr, "%v dlog hook error: %v\n", time.Now(), err)
+		}
+	}
+	return nil
+}
+
+func (core *hookCore) Sync() error {
+	var err error
+	for _, hook := range core.hooks {
+		if syncer, ok := hook.(interface{ Sync() error }); ok {
+			if syncErr := syncer.Sync(); syncErr != nil && err == nil {
+				err = syncErr
+			}
+		}
+	}
+	return err
+}
+
+// BatchConfig 遠端 sink 的緩衝與重試設定
+type BatchConfig struct {
+	// BufferSize 緩衝的筆數，滿了之後丟棄新的日誌，預設 1024
+	BufferSize int
+	// BatchSize 一次送出的筆數，預設 100
+	BatchSize int
+	// FlushInterval 沒有累積到 BatchSize 時多久送出一次，預設 1s
+	FlushInterval time.Duration
+	// MaxRetries 送出失敗時重試的次數，預設 3
+	MaxRetries int
+	// RetryBackoff 第一次重試前等待的時間，之後每次加倍，預設 100ms
+	RetryBackoff time.Duration
+}
+
+// sinkLevel sink 的最低等級，沒有設定時使用 sink 各自的預設等級
+func sinkLevel(level *Level, defaultLevel Level) Level {
+	if level == nil {
+		return defaultLevel
+	}
+	return *level
+}
+
+func (config BatchConfig) normalize() BatchConfig {
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1024
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = 3
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = 100 * time.Millisecond
+	}
+	return config
+}
+
+// permanentError 不需要重試的錯誤，例如遠端返回 4xx
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// sendFunc 送出日誌，返回已經送出的筆數，重試時從還沒送出的開始
+type sendFunc func(entries []HookEntry) (int, error)
+
+// batcher 緩衝 HookEntry 並由背景的 goroutine 批次送出，失敗時重試
+type batcher struct {
+	config  BatchConfig
+	send    sendFunc
+	queue   chan HookEntry
+	flushes chan chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	dropped uint64
+	failed  uint64
+}
+
+func newBatcher(config BatchConfig, send sendFunc) *batcher {
+	config = config.normalize()
+	b := &batcher{
+		config:  config,
+		send:    send,
+		queue:   make(chan HookEntry, config.BufferSize),
+		flushes: make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// push 緩衝滿了或已經關閉時丟棄，不會阻塞寫日誌的 goroutine
+func (b *batcher) push(entry HookEntry) error {
+	select {
+	case <-b.stop:
+		return ErrSinkClosed
+	default:
+	}
+	select {
+	case b.queue <- entry:
+	default:
+		atomic.AddUint64(&b.dropped, 1)
+	}
+	return nil
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.config.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]HookEntry, 0, b.config.BatchSize)
+	for {
+		select {
+		case entry := <-b.queue:
+			batch = append(batch, entry)
+			if len(batch) >= b.config.BatchSize {
+				batch = b.flushBatch(batch)
+			}
+		case <-ticker.C:
+			batch = b.flushBatch(batch)
+		case flushed := <-b.flushes:
+			batch = b.drain(batch)
+			close(flushed)
+		case <-b.stop:
+			b.drain(batch)
+			return
+		}
+	}
+}
+
+// drain 送出緩衝中所有的日誌
+func (b *batcher) drain(batch []HookEntry) []HookEntry {
+	for {
+		select {
+		case entry := <-b.queue:
+			batch = append(batch, entry)
+			if len(batch) >= b.config.BatchSize {
+				batch = b.flushBatch(batch)
+			}
+		default:
+			return b.flushBatch(batch)
+		}
+	}
+}
+
+func (b *batcher) flushBatch(batch []HookEntry) []HookEntry {
+	if len(batch) == 0 {
+		return batch
+	}
+	if failed, err := b.sendWithRetry(batch); err != nil {
+		atomic.AddUint64(&b.failed, uint64(failed))
+		fmt.Fprintf(os.Stderr, "%v dlog sink error: %v\n", time.Now(), err)
+	}
+	for i := range batch {
+		batch[i] = HookEntry{}
+	}
+	return batch[:0]
+}
+
+// sendWithRetry 返回最後沒有送出的筆數
+func (b *batcher) sendWithRetry(batch []HookEntry) (int, error) {
+	backoff := b.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		sent, err := b.send(batch)
+		if err == nil {
+			return 0, nil
+		}
+		batch = batch[sent:]
+		var permanent permanentError
+		if errors.As(err, &permanent) || attempt >= b.config.MaxRetries {
+			return len(batch), err
+		}
+		// 加上一些隨機的時間，避免多個實例同時重試
+		time.Sleep(backoff + time.Duration(rand.Int63n(int64(backoff)/2+1)))
+		backoff *= 2
+	}
+}
+
+// Sync 等待緩衝中的日誌送出
+func (b *batcher) Sync() error {
+	flushed := make(chan struct{})
+	select {
+	case b.flushes <- flushed:
+		<-flushed
+	case <-b.done:
+	}
+	return nil
+}
+
+// Close 送出緩衝中的日誌並停止背景的 goroutine
+func (b *batcher) Close() error {
+	b.once.Do(func() {
+		close(b.stop)
+	})
+	<-b.done
+	return nil
+}
+
+// Dropped 緩衝已滿而丟棄的數量
+func (b *batcher) Dropped() uint64 {
+	return atomic.LoadUint64(&b.dropped)
+}
+
+// Failed 重試之後仍然送出失敗的數量
+func (b *batcher) Failed() uint64 {
+	return atomic.LoadUint64(&b.failed)
+}
@@ -0,0 +1,233 @@
+package dlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_Hook(t *testing.T) {
+	core, _ := observer.New(DebugLevel)
+	var lock sync.Mutex
+	entries := make([]HookEntry, 0)
+	hook := LevelHook(WarnLevel, HookFunc(func(entry HookEntry) error {
+		lock.Lock()
+		defer lock.Unlock()
+		entries = append(entries, entry)
+		return nil
+	}))
+	logger := Config{Level: "info", Core: core, Prefix: "app", Hooks: []Hook{hook}}.Build()
+
+	logger.Info("ignored")
+	logger.With(FieldMod("client.etcd")).Error("alert", FieldKey("k"), String("password", "p"))
+
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, ErrorLevel, entries[0].Level)
+	assert.Equal(t, "app", entries[0].Logger)
+	assert.Equal(t, "alert", entries[0].Message)
+	assert.Equal(t, map[string]interface{}{"mod": "client.etcd", "key": "k", "password": DefaultRedactMask}, entries[0].Fields)
+}
+
+func Test_SyslogSink(t *testing.T) {
+	// udp
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer packetConn.Close()
+
+	sink, err := NewSyslogSink(SyslogConfig{
+		Network:     "udp",
+		Address:     packetConn.LocalAddr().String(),
+		AppName:     "digicore",
+		Hostname:    "host",
+		BatchConfig: BatchConfig{FlushInterval: 10 * time.Millisecond},
+	})
+	assert.Nil(t, err)
+	logger := Config{Level: "info", Core: newHookCore(nil), Hooks: []Hook{sink}}.Build()
+	logger.Warn("disk full", String("path", `/data "x"]`))
+	assert.Nil(t, logger.Sync())
+
+	buf := make([]byte, 1024)
+	_ = packetConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := packetConn.ReadFrom(buf)
+	assert.Nil(t, err)
+	message := string(buf[:n])
+	assert.True(t, strings.HasPrefix(message, "<12>1 "), message)
+	assert.Contains(t, message, " host digicore ")
+	assert.True(t, strings.HasSuffix(message, ` - [fields@32473 path="/data \"x\"\]"] disk full`), message)
+	assert.Nil(t, sink.Close())
+
+	// tcp，第一次連線被關閉之後重新連線
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	received := make(chan string, 10)
+	go func() {
+		first := true
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if first {
+				first = false
+				_ = conn.Close()
+				continue
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					length, err := reader.ReadString(' ')
+					if err != nil {
+						return
+					}
+					size, _ := strconv.Atoi(strings.TrimSpace(length))
+					frame := make([]byte, size)
+					if _, err := io.ReadFull(reader, frame); err != nil {
+						return
+					}
+					received <- string(frame)
+				}
+			}(conn)
+		}
+	}()
+
+	sink, err = NewSyslogSink(SyslogConfig{
+		Network:     "tcp",
+		Address:     listener.Addr().String(),
+		BatchConfig: BatchConfig{RetryBackoff: 10 * time.Millisecond, MaxRetries: 5},
+	})
+	assert.Nil(t, err)
+	// 寫入被關閉的連線可能不會立刻失敗，所以先送一筆讓 sink 發現斷線
+	for i := 0; i < 20; i++ {
+		_ = sink.Fire(HookEntry{Level: InfoLevel, Time: time.Now(), Message: "tcp " + strconv.Itoa(i)})
+		_ = sink.Sync()
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Nil(t, sink.Close())
+	select {
+	case message := <-received:
+		assert.Contains(t, message, "<14>1 ")
+		assert.Contains(t, message, " - tcp ")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no syslog message over tcp")
+	}
+}
+
+func Test_HTTPSink(t *testing.T) {
+	var lock sync.Mutex
+	requests := 0
+	batches := make([][]HookEntry, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests++
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var batch []HookEntry
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&batch))
+		batches = append(batches, batch)
+	}))
+	defer server.Close()
+
+	debug := DebugLevel
+	sink, err := NewHTTPSink(HTTPSinkConfig{
+		URL:         server.URL,
+		Level:       &debug,
+		Headers:     map[string]string{"Authorization": "Bearer token"},
+		BatchConfig: BatchConfig{BatchSize: 2, FlushInterval: time.Hour, RetryBackoff: time.Millisecond},
+	})
+	assert.Nil(t, err)
+	logger := Config{Level: "debug", Core: newHookCore(nil), Hooks: []Hook{sink}}.Build()
+	logger.Debug("first")
+	logger.Info("second", Int("n", 2))
+	logger.Warn("third")
+	assert.Nil(t, sink.Close())
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 2, len(batches))
+	assert.Equal(t, "second", batches[0][1].Message)
+	assert.Equal(t, float64(2), batches[0][1].Fields["n"])
+	assert.Equal(t, WarnLevel, batches[1][0].Level)
+	assert.Equal(t, uint64(0), sink.Failed())
+
+	// 4xx 不重試
+	rejected := 0
+	reject := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rejected++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer reject.Close()
+	sink, err = NewHTTPSink(HTTPSinkConfig{URL: reject.URL})
+	assert.Nil(t, err)
+	_ = sink.Fire(HookEntry{Message: "rejected"})
+	assert.Nil(t, sink.Close())
+	assert.Equal(t, 1, rejected)
+	assert.Equal(t, uint64(1), sink.Failed())
+}
+
+func Test_SentrySink(t *testing.T) {
+	bodies := make(chan []string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/42/envelope/", r.URL.Path)
+		assert.Contains(t, r.Header.Get("X-Sentry-Auth"), "sentry_key=public")
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- strings.Split(strings.TrimSpace(string(body)), "\n")
+	}))
+	defer server.Close()
+
+	dsn := strings.Replace(server.URL, "http://", "http://public@", 1) + "/42"
+	sink, err := NewSentrySink(SentryConfig{DSN: dsn, Environment: "test"})
+	assert.Nil(t, err)
+	logger := Config{Level: "info", Core: newHookCore(nil), Hooks: []Hook{sink}}.Build()
+	logger.Warn("not sent")
+	logger.Error("sent", FieldKey("k"))
+	assert.Nil(t, sink.Close())
+
+	assert.Equal(t, 1, len(bodies))
+	lines := <-bodies
+	assert.Equal(t, 3, len(lines))
+	header := make(map[string]string)
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &header))
+	assert.Equal(t, dsn, header["dsn"])
+	assert.Equal(t, 32, len(header["event_id"]))
+	assert.Contains(t, lines[1], `"type":"event"`)
+
+	event := make(map[string]interface{})
+	assert.Nil(t, json.Unmarshal([]byte(lines[2]), &event))
+	assert.Equal(t, header["event_id"], event["event_id"])
+	assert.Equal(t, "error", event["level"])
+	assert.Equal(t, "sent", event["message"])
+	assert.Equal(t, "test", event["environment"])
+	assert.Equal(t, map[string]interface{}{"key": "k"}, event["extra"])
+
+	// 沒有設定 Level 時為 error，設定之後以設定為準
+	assert.False(t, sink.Enabled(WarnLevel))
+	assert.True(t, sink.Enabled(ErrorLevel))
+	warn := WarnLevel
+	warnSink, err := NewSentrySink(SentryConfig{DSN: dsn, Level: &warn})
+	assert.Nil(t, err)
+	assert.True(t, warnSink.Enabled(WarnLevel))
+	assert.False(t, warnSink.Enabled(InfoLevel))
+	assert.Nil(t, warnSink.Close())
+
+	_, err = NewSentrySink(SentryConfig{DSN: "https://sentry.example.com/42"})
+	assert.NotNil(t, err)
+}
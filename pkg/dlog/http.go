@@ -0,0 +1,71 @@
+package dlog
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// levelPayload LevelHandler 讀寫的格式
+type levelPayload struct {
+	// Level 全域等級，或是 Module 的等級，Module 有值而 Level 為空時移除該 mod 的設定
+	Level string `json:"level"`
+	// Module 要調整的 mod，空的時候調整全域等級
+	Module string `json:"module,omitempty"`
+	// Modules 目前所有 mod 的等級，只在讀取時使用
+	Modules map[string]string `json:"modules,omitempty"`
+}
+
+// LevelHandler 在執行期間讀取或調整等級的 http handler，
+// GET 返回目前的等級，PUT 或 POST 送出 {"level":"debug"} 調整全域等級，
+// 送出 {"module":"client.etcd","level":"debug"} 調整單一 mod，只有帶 module 時 level 才可以為空
+func LevelHandler(logger *Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var payload levelPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				writeLevelError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if payload.Level == "" {
+				// 空的等級只用來移除 mod 的設定，全域等級必須明確指定
+				if payload.Module == "" {
+					writeLevelError(w, http.StatusBadRequest, "level is required")
+					return
+				}
+				logger.UnsetModuleLevel(payload.Module)
+				break
+			}
+			var level Level
+			if err := level.UnmarshalText([]byte(payload.Level)); err != nil {
+				writeLevelError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if payload.Module != "" {
+				logger.SetModuleLevel(payload.Module, level)
+			} else {
+				logger.SetLevel(level)
+			}
+		default:
+			writeLevelError(w, http.StatusMethodNotAllowed, "only GET, PUT and POST are supported")
+			return
+		}
+
+		payload := levelPayload{
+			Level:   logger.Level().String(),
+			Modules: make(map[string]string),
+		}
+		for mod, level := range logger.ModuleLevels() {
+			payload.Modules[mod] = level.String()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(payload)
+	})
+}
+
+func writeLevelError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,143 @@
+package dlog
+
+import (
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// levelRegistry 全域等級以及依照 mod 欄位設定的等級，
+// mod 以 . 分層，沒有設定時往上一層找，例如 client.etcd.kv 會依序找 client.etcd、client
+type levelRegistry struct {
+	lv      zap.AtomicLevel
+	lock    sync.RWMutex
+	modules map[string]zapcore.Level
+}
+
+func newLevelRegistry(lv zap.AtomicLevel) *levelRegistry {
+	return &levelRegistry{
+		lv:      lv,
+		modules: make(map[string]zapcore.Level),
+	}
+}
+
+// enabled 判斷 mod 在這個等級是否要輸出
+func (registry *levelRegistry) enabled(mod string, level zapcore.Level) bool {
+	if mod != "" {
+		registry.lock.RLock()
+		if len(registry.modules) > 0 {
+			for name := mod; ; {
+				if modLevel, ok := registry.modules[name]; ok {
+					registry.lock.RUnlock()
+					return modLevel.Enabled(level)
+				}
+				index := strings.LastIndex(name, ".")
+				if index < 0 {
+					break
+				}
+				name = name[:index]
+			}
+		}
+		registry.lock.RUnlock()
+	}
+	return registry.lv.Enabled(level)
+}
+
+// hasModules 是否有任何 mod 的等級設定
+func (registry *levelRegistry) hasModules() bool {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	return len(registry.modules) > 0
+}
+
+// anyEnabled 全域等級或任何一個 mod 在這個等級會輸出
+func (registry *levelRegistry) anyEnabled(level zapcore.Level) bool {
+	if registry.lv.Enabled(level) {
+		return true
+	}
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	for _, modLevel := range registry.modules {
+		if modLevel.Enabled(level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (registry *levelRegistry) setModule(mod string, level zapcore.Level) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.modules[normalizeMod(mod)] = level
+}
+
+func (registry *levelRegistry) unsetModule(mod string) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	delete(registry.modules, normalizeMod(mod))
+}
+
+// replaceModules 整個換掉 mod 的等級設定
+func (registry *levelRegistry) replaceModules(modules map[string]zapcore.Level) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.modules = make(map[string]zapcore.Level, len(modules))
+	for mod, level := range modules {
+		registry.modules[normalizeMod(mod)] = level
+	}
+}
+
+func (registry *levelRegistry) snapshot() map[string]zapcore.Level {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	modules := make(map[string]zapcore.Level, len(registry.modules))
+	for mod, level := range registry.modules {
+		modules[mod] = level
+	}
+	return modules
+}
+
+// normalizeMod 與 FieldMod 相同的規則
+func normalizeMod(mod string) string {
+	return strings.Replace(mod, " ", ".", -1)
+}
+
+// parseModuleLevels 解析設定檔中的 ModuleLevels
+func parseModuleLevels(modules map[string]string) (map[string]zapcore.Level, error) {
+	levels := make(map[string]zapcore.Level, len(modules))
+	for mod, text := range modules {
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(text)); err != nil {
+			return nil, err
+		}
+		levels[mod] = level
+	}
+	return levels, nil
+}
+
+// Level 目前的全域等級
+func (logger *Logger) Level() Level {
+	return logger.lv.Level()
+}
+
+// SetLevel 調整全域等級，With 出來的 logger 也會一起改變
+func (logger *Logger) SetLevel(level Level) {
+	logger.lv.SetLevel(level)
+}
+
+// SetModuleLevel 單獨調整某個 mod 的等級，可以比全域等級更低或更高
+func (logger *Logger) SetModuleLevel(mod string, level Level) {
+	logger.state.levels.setModule(mod, level)
+}
+
+// UnsetModuleLevel 移除 mod 的等級設定，回到全域等級
+func (logger *Logger) UnsetModuleLevel(mod string) {
+	logger.state.levels.unsetModule(mod)
+}
+
+// ModuleLevels 目前所有 mod 的等級設定
+func (logger *Logger) ModuleLevels() map[string]Level {
+	return logger.state.levels.snapshot()
+}
@@ -2,10 +2,21 @@ package dlog
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/BurntSushi/toml"
 	"github.com/digital-monster-1997/digicore/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 
@@ -32,3 +43,514 @@ func Test_Info(t *testing.T) {
 	systemLogger.Debug("gg88g88",FieldAddr("192.168.11.0"))
 }
 
+
+func Test_Outputs(t *testing.T) {
+	dir := t.TempDir()
+	logger := Config{
+		Level: "debug",
+		Outputs: []OutputConfig{
+			{Type: OutputStdout},
+			{Type: OutputFile, Level: "warn", Encoder: EncoderJSON, Filename: filepath.Join(dir, "app.log")},
+		},
+		Debug: true,
+	}.Build()
+
+	logger.Info("info message")
+	logger.Warn("warn message", FieldKey("k"))
+	assert.Nil(t, logger.Close())
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 1)
+
+	entry := make(map[string]interface{})
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "WARN", entry["lv"])
+	assert.Equal(t, "k", entry["key"])
+}
+
+func Test_FileRotate(t *testing.T) {
+	dir := t.TempDir()
+	logger := Config{
+		Level: "info",
+		Outputs: []OutputConfig{
+			{Type: OutputFile, Filename: filepath.Join(dir, "app.log"), RotateInterval: 50 * time.Millisecond, Compress: true, MaxBackups: 2},
+		},
+	}.Build()
+	defer logger.Close()
+
+	assert.Eventually(t, func() bool {
+		logger.Info("rotate")
+		files, _ := filepath.Glob(filepath.Join(dir, "app-*.log.gz"))
+		return len(files) > 0
+	}, 3*time.Second, 20*time.Millisecond)
+}
+
+func Test_ModuleLevel(t *testing.T) {
+	core, logs := observer.New(DebugLevel)
+	logger := Config{Level: "info", Core: core, ModuleLevels: map[string]string{"client": "debug"}}.Build()
+	etcdLogger := logger.With(FieldMod("client.etcd"))
+
+	logger.Debug("root debug")
+	etcdLogger.Debug("etcd debug")
+	assert.Equal(t, 1, logs.FilterMessage("etcd debug").Len())
+	assert.Equal(t, 0, logs.FilterMessage("root debug").Len())
+
+	logger.SetLevel(DebugLevel)
+	logger.Debug("root debug")
+	assert.Equal(t, 1, logs.FilterMessage("root debug").Len())
+	assert.Equal(t, DebugLevel, etcdLogger.Level())
+
+	logger.SetModuleLevel("client.etcd", ErrorLevel)
+	etcdLogger.Warn("etcd warn")
+	assert.Equal(t, 0, logs.FilterMessage("etcd warn").Len())
+
+	logger.UnsetModuleLevel("client.etcd")
+	etcdLogger.Warn("etcd warn")
+	assert.Equal(t, 1, logs.FilterMessage("etcd warn").Len())
+
+	// 呼叫時才帶上的 mod 也依照 mod 的等級，最後一個 mod 為準
+	logger.SetLevel(InfoLevel)
+	logger.SetModuleLevel("file datasource", ErrorLevel)
+	logger.Warn("call site warn", FieldMod("file datasource"))
+	logger.Error("call site error", FieldMod("file datasource"))
+	logger.Debug("call site debug", FieldMod("client.etcd"))
+	logger.Debug("root debug after modules")
+	etcdLogger.Warn("override warn", FieldMod("file.datasource"))
+	assert.Equal(t, 0, logs.FilterMessage("call site warn").Len())
+	assert.Equal(t, 1, logs.FilterMessage("call site error").Len())
+	assert.Equal(t, 1, logs.FilterMessage("call site debug").Len())
+	assert.Equal(t, 0, logs.FilterMessage("root debug after modules").Len())
+	assert.Equal(t, 0, logs.FilterMessage("override warn").Len())
+}
+
+func Test_LevelHandler(t *testing.T) {
+	core, _ := observer.New(DebugLevel)
+	logger := Config{Level: "info", Core: core}.Build()
+	handler := LevelHandler(logger)
+
+	request := func(method, body string) (int, map[string]interface{}) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, "/log/level", strings.NewReader(body)))
+		payload := make(map[string]interface{})
+		_ = json.Unmarshal(recorder.Body.Bytes(), &payload)
+		return recorder.Code, payload
+	}
+
+	code, payload := request(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "info", payload["level"])
+
+	code, payload = request(http.MethodPut, `{"level":"warn"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "warn", payload["level"])
+	assert.Equal(t, WarnLevel, logger.Level())
+
+	code, payload = request(http.MethodPost, `{"module":"client.etcd","level":"debug"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"client.etcd": "debug"}, payload["modules"])
+
+	code, _ = request(http.MethodPost, `{"module":"client.etcd"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, logger.ModuleLevels())
+
+	code, _ = request(http.MethodPut, `{"level":"loud"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, payload = request(http.MethodPut, `{"level":""}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "level is required", payload["error"])
+	code, _ = request(http.MethodPut, `{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, WarnLevel, logger.Level())
+	code, _ = request(http.MethodDelete, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+}
+
+type memoryDataSource struct {
+	content string
+}
+
+func (ds *memoryDataSource) ReadConfig() ([]byte, error)      { return []byte(ds.content), nil }
+func (ds *memoryDataSource) IsConfigChanged() <-chan struct{} { return nil }
+func (ds *memoryDataSource) Close() error                     { return nil }
+
+func Test_Bind(t *testing.T) {
+	dir := t.TempDir()
+	conf := config.New()
+	ds := &memoryDataSource{content: `
+[log]
+Level = "info"
+`}
+	assert.Nil(t, conf.LoadFromDataSource(ds, toml.Unmarshal))
+
+	logger := RawConfig("log", &Config{}, conf).Build()
+	child := logger.With(FieldMod("worker"))
+	logger.Bind("log", conf)
+
+	ds.content = fmt.Sprintf(`
+[log]
+Level = "debug"
+[log.ModuleLevels]
+worker = "error"
+[[log.Outputs]]
+Type = "file"
+Filename = %q
+`, filepath.Join(dir, "app.log"))
+	assert.Nil(t, conf.LoadFromDataSource(ds, toml.Unmarshal))
+
+	assert.Equal(t, DebugLevel, logger.Level())
+	assert.Equal(t, map[string]Level{"worker": ErrorLevel}, logger.ModuleLevels())
+
+	logger.Debug("to file")
+	child.Warn("dropped")
+	child.Error("kept")
+	assert.Nil(t, logger.Close())
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "to file")
+	assert.Contains(t, string(content), "kept")
+	assert.NotContains(t, string(content), "dropped")
+}
+
+func Test_ReloadSampling(t *testing.T) {
+	core, logs := observer.New(DebugLevel)
+	logger := Config{
+		Level:    "info",
+		Core:     core,
+		Sampling: &SamplingConfig{Tick: time.Hour, Initial: 1},
+	}.Build()
+	logger.Info("sampled")
+	logger.Info("sampled")
+	assert.Equal(t, 1, logs.FilterMessage("sampled").Len())
+
+	// 新的設定沒有 Sampling 時不再取樣
+	conf := config.New()
+	assert.Nil(t, conf.LoadFromDataSource(&memoryDataSource{content: `
+[log]
+Level = "info"
+`}, toml.Unmarshal))
+	assert.Nil(t, logger.reload("log", conf))
+	for i := 0; i < 3; i++ {
+		logger.Info("not sampled")
+	}
+	assert.Equal(t, 3, logs.FilterMessage("not sampled").Len())
+}
+
+func Test_Async(t *testing.T) {
+	core, logs := observer.New(DebugLevel)
+	logger := Config{
+		Level: "info",
+		Core:  core,
+		Async: &AsyncConfig{BufferSize: 16, BatchSize: 4, FlushInterval: time.Hour},
+	}.Build()
+
+	for i := 0; i < 100; i++ {
+		logger.Info("async message", Int("i", i))
+	}
+	assert.Nil(t, logger.Sync())
+	assert.Equal(t, 100, logs.FilterMessage("async message").Len())
+	assert.Equal(t, uint64(0), logger.Dropped())
+
+	logger.Info("before panic")
+	assert.Panics(t, func() {
+		logger.Panic("panic message")
+	})
+	all := logs.All()
+	assert.Equal(t, "before panic", all[len(all)-2].Message)
+	assert.Equal(t, "panic message", all[len(all)-1].Message)
+
+	logger.Warn("before close")
+	assert.Nil(t, logger.Close())
+	assert.Equal(t, 1, logs.FilterMessage("before close").Len())
+}
+
+func Test_AsyncOverflow(t *testing.T) {
+	for _, overflow := range []string{OverflowDropOldest, OverflowDropNewest} {
+		core, logs := observer.New(DebugLevel)
+		logger := Config{
+			Level: "info",
+			Core:  core,
+			Async: &AsyncConfig{BufferSize: 4, FlushInterval: time.Hour, Overflow: overflow},
+		}.Build()
+
+		for i := 0; i < 1000; i++ {
+			logger.Info("overflow message", Int("i", i))
+		}
+		assert.Nil(t, logger.Close())
+		assert.Equal(t, 1000, logs.Len()+int(logger.Dropped()), overflow)
+		if overflow == OverflowDropOldest {
+			all := logs.All()
+			assert.Equal(t, int64(999), all[len(all)-1].ContextMap()["i"])
+		}
+	}
+
+	core, _ := observer.New(DebugLevel)
+	logger := Config{Level: "info", Core: core}.Build()
+	assert.NotNil(t, logger.Reconfigure(Config{Level: "info", Core: core, Async: &AsyncConfig{Overflow: "unknown"}}))
+}
+
+func Test_Sampling(t *testing.T) {
+	core, logs := observer.New(DebugLevel)
+	logger := Config{
+		Level:    "info",
+		Core:     core,
+		Sampling: &SamplingConfig{Tick: time.Minute, Initial: 3, Thereafter: 10},
+	}.Build()
+
+	for i := 0; i < 33; i++ {
+		logger.Error("noisy error")
+	}
+	logger.Error("other error")
+	assert.Equal(t, 6, logs.FilterMessage("noisy error").Len())
+	assert.Equal(t, 1, logs.FilterMessage("other error").Len())
+}
+
+func Test_Every(t *testing.T) {
+	core, logs := observer.New(DebugLevel)
+	logger := Config{Level: "info", Core: core}.Build()
+
+	for i := 0; i < 5; i++ {
+		logger.Every(time.Hour).Warn("limited")
+	}
+	assert.Equal(t, 1, logs.FilterMessage("limited").Len())
+
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			time.Sleep(30 * time.Millisecond)
+		}
+		logger.Every(20 * time.Millisecond).Warn("interval")
+	}
+	entries := logs.FilterMessage("interval").All()
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, int64(1), entries[1].ContextMap()["suppressed"])
+}
+
+func Test_Dedup(t *testing.T) {
+	core, logs := observer.New(DebugLevel)
+	logger := Config{Level: "info", Core: core, Dedup: time.Hour}.Build()
+
+	for i := 0; i < 5; i++ {
+		logger.Error("repeat", FieldKey("k"))
+	}
+	logger.Error("repeat", FieldKey("other"))
+	logger.Error("done")
+	assert.Nil(t, logger.Sync())
+
+	messages := make([]string, 0)
+	for _, entry := range logs.All() {
+		messages = append(messages, entry.Message)
+	}
+	assert.Equal(t, []string{"repeat", "message repeated 4 times", "repeat", "done"}, messages)
+	assert.Equal(t, "repeat", logs.All()[1].ContextMap()["repeated_msg"])
+
+	logger = Config{Level: "info", Core: core, Dedup: 20 * time.Millisecond}.Build()
+	logs.TakeAll()
+	logger.Warn("flushed later")
+	logger.Warn("flushed later")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, logs.FilterMessage("message repeated 1 times").Len())
+}
+
+func Test_Context(t *testing.T) {
+	core, logs := observer.New(DebugLevel)
+	logger := Config{Level: "info", Core: core}.Build()
+
+	ctx := ContextWithTraceID(context.Background(), "trace-1")
+	ctx = ContextWithRequestID(ctx, "req-1")
+	ctx = NewContext(ctx, logger.Ctx(ctx))
+	ctx = ContextWithUserID(ctx, "user-1")
+	assert.Equal(t, "trace-1", TraceIDFromContext(ctx))
+	assert.Equal(t, "", SpanIDFromContext(ctx))
+
+	WithContext(ctx).Info("handle request")
+	entry := logs.TakeAll()[0]
+	assert.Equal(t, map[string]interface{}{"trace_id": "trace-1", "request_id": "req-1", "user_id": "user-1"}, entry.ContextMap())
+	assert.Equal(t, 3, len(entry.Context))
+
+	assert.Equal(t, DigitCore, FromContext(context.Background()))
+	assert.Equal(t, logger, logger.Ctx(context.Background()))
+}
+
+func Test_Fatal(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		core, logs := observer.New(DebugLevel)
+		codes := make([]int, 0)
+		logger := Config{
+			Level:    "info",
+			Core:     core,
+			Debug:    debug,
+			ExitFunc: func(code int) { codes = append(codes, code) },
+		}.Build()
+
+		logger.Fatal("fatal message")
+		logger.Fatalf("fatal %s", "formatted")
+		logger.Fatalw("fatal with", "k", "v")
+		assert.Equal(t, []int{1, 1, 1}, codes)
+		assert.Equal(t, 3, logs.FilterLevelExact(FatalLevel).Len())
+
+		assert.Panics(t, func() {
+			logger.Panic("panic message")
+		})
+		assert.Equal(t, 1, logs.FilterLevelExact(PanicLevel).Len())
+
+		// Debug 模式的 DPanic 只記錄不 panic
+		assert.NotPanics(t, func() {
+			logger.DPanic("dpanic message")
+		})
+		assert.Equal(t, 1, logs.FilterLevelExact(zapcore.DPanicLevel).Len())
+	}
+}
+
+func Test_PrefixAndCaller(t *testing.T) {
+	core, logs := observer.New(DebugLevel)
+	logger := Config{
+		Level:     "info",
+		Core:      core,
+		Prefix:    "GameCore",
+		AddCaller: true,
+		Fields:    []Field{String("app", "digicore")},
+	}.Build()
+
+	logger.Info("method")
+	original := DigitCore
+	DigitCore = logger
+	defer func() { DigitCore = original }()
+	Info("helper")
+	Infof("helper %s", "formatted")
+
+	for _, entry := range logs.All() {
+		assert.Equal(t, "GameCore", entry.LoggerName)
+		assert.Equal(t, "digicore", entry.ContextMap()["app"])
+		assert.True(t, strings.HasSuffix(entry.Caller.File, "log_test.go"), entry.Caller.File)
+	}
+	assert.Equal(t, 3, logs.Len())
+}
+
+type testCodedError struct{}
+
+func (testCodedError) Error() string  { return "coded" }
+func (testCodedError) Code() int32    { return 5 }
+func (testCodedError) Kind() string   { return "user" }
+func (testCodedError) Stack() string  { return "stack" }
+
+func Test_FieldErr(t *testing.T) {
+	core, logs := observer.New(DebugLevel)
+	logger := Config{Level: "info", Core: core}.Build()
+
+	logger.Error("coded", FieldErr(fmt.Errorf("wrap: %w", testCodedError{})))
+	logger.Error("plain", FieldErr(fmt.Errorf("plain")))
+	entries := logs.All()
+	assert.Equal(t, map[string]interface{}{
+		"error":    "wrap: coded",
+		"code":     int32(5),
+		"errKind":  "user",
+		"errStack": "stack",
+	}, entries[0].ContextMap())
+	assert.Equal(t, map[string]interface{}{"error": "plain"}, entries[1].ContextMap())
+}
+
+type redactAccount struct {
+	Name   string `json:"name"`
+	Pin    string `json:"pin" log:"secret"`
+	Token  string
+	Nested struct {
+		Password string `json:"password"`
+		Port     int    `json:"port"`
+	} `json:"nested"`
+	Created time.Time `json:"created"`
+}
+
+type redactObject struct{}
+
+func (redactObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("user", "alice")
+	enc.AddString("api_key", "k-123")
+	return nil
+}
+
+// redactTypedObject 以字串以外的型別寫入需要遮蔽的欄位
+type redactTypedObject struct{}
+
+func (redactTypedObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("password", 1234)
+	enc.AddUint64("pin", 42)
+	enc.AddBool("token", true)
+	enc.AddFloat64("api_key", 1.5)
+	enc.AddTime("password_changed", time.Unix(0, 0))
+	enc.AddInt("port", 80)
+	return enc.AddArray("accounts", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+		return arr.AppendObject(redactObject{})
+	}))
+}
+
+func Test_Redact(t *testing.T) {
+	core, logs := observer.New(DebugLevel)
+	logger := Config{Level: "info", Core: core, RedactKeys: []string{"*password*", "token", "api_key", "pin"}}.Build()
+
+	account := redactAccount{Name: "alice", Pin: "1234", Token: "t-1"}
+	account.Nested.Password = "p"
+	account.Nested.Port = 80
+	logger.With(String("password", "p")).Info("redact",
+		Any("account", account),
+		Any("headers", map[string]interface{}{"Token": "t-2", "Accept": "json"}),
+		Object("object", redactObject{}),
+		Object("typed", redactTypedObject{}),
+		Int("password_retries", 3),
+		Array("objects", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			return arr.AppendObject(redactObject{})
+		})),
+		String("name", "alice"),
+	)
+
+	entry := logs.All()[0]
+	encoded, err := zapcore.NewJSONEncoder(zapcore.EncoderConfig{}).EncodeEntry(entry.Entry, entry.Context)
+	assert.Nil(t, err)
+	payload := make(map[string]interface{})
+	assert.Nil(t, json.Unmarshal(encoded.Bytes(), &payload))
+
+	assert.Equal(t, DefaultRedactMask, payload["password"])
+	assert.Equal(t, "alice", payload["name"])
+	accountPayload := payload["account"].(map[string]interface{})
+	assert.Equal(t, "alice", accountPayload["name"])
+	assert.Equal(t, DefaultRedactMask, accountPayload["pin"])
+	assert.Equal(t, DefaultRedactMask, accountPayload["Token"])
+	assert.Equal(t, map[string]interface{}{"password": DefaultRedactMask, "port": float64(80)}, accountPayload["nested"])
+	assert.Equal(t, "0001-01-01T00:00:00Z", accountPayload["created"])
+	assert.Equal(t, map[string]interface{}{"Token": DefaultRedactMask, "Accept": "json"}, payload["headers"])
+	assert.Equal(t, map[string]interface{}{"user": "alice", "api_key": DefaultRedactMask}, payload["object"])
+	assert.Equal(t, map[string]interface{}{
+		"password":         DefaultRedactMask,
+		"pin":              DefaultRedactMask,
+		"token":            DefaultRedactMask,
+		"api_key":          DefaultRedactMask,
+		"password_changed": DefaultRedactMask,
+		"port":             float64(80),
+		"accounts":         []interface{}{map[string]interface{}{"user": "alice", "api_key": DefaultRedactMask}},
+	}, payload["typed"])
+	assert.Equal(t, DefaultRedactMask, payload["password_retries"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"user": "alice", "api_key": DefaultRedactMask}}, payload["objects"])
+
+	logger = Config{Level: "info", Core: core, DisableRedact: true}.Build()
+	logger.Info("plain", String("password", "p"))
+	assert.Equal(t, "p", logs.FilterMessage("plain").All()[0].ContextMap()["password"])
+}
+
+func Test_RedactPanicDetail(t *testing.T) {
+	var buf bytes.Buffer
+	original := panicDetailOutput
+	panicDetailOutput = &buf
+	defer func() { panicDetailOutput = original }()
+
+	// Debug 模式在控制台輸出的 panic 詳情也要遮蔽
+	core, logs := observer.New(DebugLevel)
+	logger := Config{Level: "info", Core: core, Debug: true}.Build()
+	assert.Panics(t, func() {
+		logger.Panic("panic detail", String("password", "p-1"), String("name", "alice"))
+	})
+	assert.Contains(t, buf.String(), DefaultRedactMask)
+	assert.Contains(t, buf.String(), "alice")
+	assert.NotContains(t, buf.String(), "p-1")
+	assert.Equal(t, DefaultRedactMask, logs.FilterMessageSnippet("panic detail").All()[0].ContextMap()["password"])
+}
@@ -5,8 +5,11 @@ import (
 	"github.com/digital-monster-1997/digicore/pkg/utils/dcolor"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"io"
 	"log"
+	"os"
 	"runtime"
+	"sync"
 )
 
 const (
@@ -35,9 +38,11 @@ var (
 	Int = zap.Int
 	Int32 = zap.Int32
 	Uint = zap.Uint
+	Float64 = zap.Float64
 	Duration = zap.Duration
 	Durationp = zap.Durationp
 	Object = zap.Object
+	Array = zap.Array
 	Namespace = zap.Namespace
 	Reflect = zap.Reflect
 	Skip = zap.Skip()
@@ -49,6 +54,31 @@ type Logger struct {
 	sugar 	*zap.SugaredLogger
 	lv 		*zap.AtomicLevel
 	desugar *zap.Logger
+	// state With 出來的 logger 共用同一份
+	state *loggerState
+	// ctxIDs Ctx 已經附加過的 id
+	ctxIDs map[string]string
+	// helper 給套件層級的函式使用，多跳過一層 caller
+	helper *Logger
+}
+
+// loggerState 可以在執行期間調整的部分
+type loggerState struct {
+	levels *levelRegistry
+	holder *coreHolder
+	lock   sync.Mutex
+	// config 最近一次套用的設定
+	config Config
+	// dropped 非同步緩衝丟棄的數量，重新設定之後繼續累計
+	dropped *uint64
+	// callSites Every 在每個呼叫位置的狀態
+	callSites sync.Map
+}
+
+func (state *loggerState) currentConfig() Config {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.config
 }
 
 // IsDebugMode ...
@@ -70,6 +100,42 @@ func sprintf(template string, args ...interface{}) string {
 	return msg
 }
 
+// Sync 把緩衝中的日誌寫出
+func (logger *Logger) Sync() error {
+	return logger.desugar.Sync()
+}
+
+// Close 寫出緩衝中的日誌並關閉檔案等輸出，關閉後不應再使用這個 logger 以及 With 出來的 logger
+func (logger *Logger) Close() error {
+	return logger.state.holder.load().close()
+}
+
+// Reconfigure 依照新的設定調整 Level、ModuleLevels 與輸出，With 出來的 logger 也會一起改變，
+// AddCaller、CallerSkip、Prefix、Fields、Debug 只在 Build 時生效
+func (logger *Logger) Reconfigure(config Config) error {
+	config.normalize()
+	var level Level
+	if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+		return err
+	}
+	modules, err := parseModuleLevels(config.ModuleLevels)
+	if err != nil {
+		return err
+	}
+	gen, err := config.buildGeneration(logger.state.dropped)
+	if err != nil {
+		return err
+	}
+
+	logger.state.lock.Lock()
+	defer logger.state.lock.Unlock()
+	logger.state.holder.swap(gen)
+	logger.lv.SetLevel(level)
+	logger.state.levels.replaceModules(modules)
+	logger.state.config = config
+	return nil
+}
+
 // StdLog ...
 func (logger *Logger) StdLog() *log.Logger {
 	return zap.NewStdLog(logger.desugar)
@@ -108,7 +174,7 @@ func (logger *Logger) Error(msg string, fields ...Field) {
 
 func (logger *Logger) Panic(msg string, fields ...Field) {
 	if logger.IsDebugMode() {
-		panicDetail(msg, fields...)
+		logger.panicDetail(msg, fields...)
 		msg = normalizeMessage(msg)
 	}
 	logger.desugar.Panic(msg, fields...)
@@ -116,21 +182,35 @@ func (logger *Logger) Panic(msg string, fields ...Field) {
 
 func (logger *Logger) DPanic(msg string, fields ...Field) {
 	if logger.IsDebugMode() {
-		panicDetail(msg, fields...)
+		logger.panicDetail(msg, fields...)
 		msg = normalizeMessage(msg)
 	}
 	logger.desugar.DPanic(msg, fields...)
 }
 
+// Fatal 寫入之後呼叫 ExitFunc 結束程式，Debug 模式也一樣
 func (logger *Logger) Fatal(msg string, fields ...Field) {
+	defer logger.exit()
 	if logger.IsDebugMode() {
-		panicDetail(msg, fields...)
+		logger.panicDetail(msg, fields...)
 		msg = normalizeMessage(msg)
-		return
 	}
 	logger.desugar.Fatal(msg, fields...)
 }
 
+// exit 攔下 Fatal 寫入之後的 panic，寫出緩衝再呼叫 ExitFunc
+func (logger *Logger) exit() {
+	if recover() == nil {
+		return
+	}
+	_ = logger.Sync()
+	exit := logger.config.ExitFunc
+	if exit == nil {
+		exit = os.Exit
+	}
+	exit(1)
+}
+
 //-------------------------- 格式化的 --------------------------
 
 func (logger *Logger) Debugf(template string, args ...interface{}) {
@@ -158,6 +238,7 @@ func (logger *Logger) DPanicf(template string, args ...interface{}) {
 }
 
 func (logger *Logger) Fatalf(template string, args ...interface{}) {
+	defer logger.exit()
 	logger.sugar.Fatalf(sprintf(template, args...))
 }
 //-------------------------- 記錄一些附加上下文的消息。可變參數鍵值對在 With 中的處理方式相同 --------------------------
@@ -205,24 +286,32 @@ func (logger *Logger) DPanicw(msg string, keysAndValues ...interface{}) {
 }
 
 func (logger *Logger) Fatalw(msg string, keysAndValues ...interface{}) {
+	defer logger.exit()
 	if logger.IsDebugMode() {
 		msg = normalizeMessage(msg)
 	}
 	logger.sugar.Fatalw(msg, keysAndValues...)
 }
-func panicDetail(msg string, fields ...Field) {
+// panicDetailOutput Debug 模式輸出 panic 詳情的位置，測試時替換
+var panicDetailOutput io.Writer = os.Stdout
+
+// panicDetail Debug 模式在控制台輸出 panic 詳情，欄位與寫入日誌時一樣先經過遮蔽
+func (logger *Logger) panicDetail(msg string, fields ...Field) {
+	if redactor := logger.state.holder.load().redactor; redactor != nil {
+		fields = redactor.fields(fields)
+	}
 	enc := zapcore.NewMapObjectEncoder()
 	for _, field := range fields {
 		field.AddTo(enc)
 	}
 
 	// 控制台输出
-	fmt.Printf("%s: \n    %s: %s\n", dcolor.Red("panic"), dcolor.Red("msg"), msg)
+	fmt.Fprintf(panicDetailOutput, "%s: \n    %s: %s\n", dcolor.Red("panic"), dcolor.Red("msg"), msg)
 	if _, file, line, ok := runtime.Caller(3); ok {
-		fmt.Printf("    %s: %s:%d\n", dcolor.Red("loc"), file, line)
+		fmt.Fprintf(panicDetailOutput, "    %s: %s:%d\n", dcolor.Red("loc"), file, line)
 	}
 	for key, val := range enc.Fields {
-		fmt.Printf("    %s: %s\n", dcolor.Red(key), fmt.Sprintf("%+v", val))
+		fmt.Fprintf(panicDetailOutput, "    %s: %s\n", dcolor.Red(key), fmt.Sprintf("%+v", val))
 	}
 
 }
@@ -235,5 +324,7 @@ func (logger *Logger) With(fields ...Field) *Logger {
 		lv:      logger.lv,
 		sugar:   desugarLogger.Sugar(),
 		config:  logger.config,
+		state:   logger.state,
+		ctxIDs:  logger.ctxIDs,
 	}
 }
@@ -0,0 +1,165 @@
+package dlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	// OutputStdout 輸出到標準輸出
+	OutputStdout = "stdout"
+	// OutputStderr 輸出到標準錯誤
+	OutputStderr = "stderr"
+	// OutputFile 輸出到檔案，支援依大小與時間輪替
+	OutputFile = "file"
+
+	// EncoderJSON 以 json 格式輸出
+	EncoderJSON = "json"
+	// EncoderConsole 以人類易讀的格式輸出
+	EncoderConsole = "console"
+)
+
+// OutputConfig 單一輸出目的地的設定
+type OutputConfig struct {
+	// Type stdout、stderr 或 file
+	Type string
+	// Level 這個輸出的最低等級，空的時候只受 Config.Level 限制
+	Level string
+	// Encoder json 或 console，空的時候 Debug 模式用 console，否則用 json
+	Encoder string
+
+	// 以下只有 file 使用
+	// Filename 檔案路徑，目錄不存在時會自動建立
+	Filename string
+	// MaxSize 單一檔案的大小上限，單位 MB，預設 100
+	MaxSize int
+	// MaxAge 舊檔案保留的天數，0 表示不依時間刪除
+	MaxAge int
+	// MaxBackups 舊檔案保留的數量，0 表示全部保留
+	MaxBackups int
+	// Compress 舊檔案是否以 gzip 壓縮
+	Compress bool
+	// LocalTime 舊檔案的檔名是否使用本地時間，預設為 UTC
+	LocalTime bool
+	// RotateInterval 每隔多久輪替一次，0 表示只依大小輪替
+	RotateInterval time.Duration
+}
+
+// build 建立這個輸出的 core，需要關閉的資源會放在 closer 中
+func (output OutputConfig) build(config *Config) (zapcore.Core, io.Closer, error) {
+	sinkLevel := zapcore.DebugLevel
+	if output.Level != "" {
+		if err := sinkLevel.UnmarshalText([]byte(output.Level)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	encoderConfig := *config.EncoderConfig
+	var (
+		ws     zapcore.WriteSyncer
+		closer io.Closer
+	)
+	switch output.Type {
+	case OutputStdout, "":
+		ws = zapcore.Lock(stdWriter{os.Stdout})
+	case OutputStderr:
+		ws = zapcore.Lock(stdWriter{os.Stderr})
+	case OutputFile:
+		if output.Filename == "" {
+			return nil, nil, fmt.Errorf("dlog: file output without filename")
+		}
+		writer := newFileWriter(output)
+		ws, closer = writer, writer
+		// 檔案中不需要顏色
+		if config.Debug {
+			encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		}
+	default:
+		return nil, nil, fmt.Errorf("dlog: unknown output type %q", output.Type)
+	}
+
+	var encoder zapcore.Encoder
+	switch output.Encoder {
+	case EncoderJSON:
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	case EncoderConsole:
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	case "":
+		if config.Debug {
+			encoder = zapcore.NewConsoleEncoder(encoderConfig)
+		} else {
+			encoder = zapcore.NewJSONEncoder(encoderConfig)
+		}
+	default:
+		return nil, nil, fmt.Errorf("dlog: unknown encoder %q", output.Encoder)
+	}
+
+	// 全域與 mod 的等級由 levelCore 判斷，這裡只看輸出自己的等級
+	return zapcore.NewCore(encoder, ws, sinkLevel), closer, nil
+}
+
+// stdWriter 標準輸出在 pipe 或終端機上 Sync 會回傳錯誤，直接忽略
+type stdWriter struct {
+	*os.File
+}
+
+func (writer stdWriter) Sync() error {
+	return nil
+}
+
+// fileWriter 依大小輪替的檔案，另外可以依時間定期輪替
+type fileWriter struct {
+	*lumberjack.Logger
+	stop chan struct{}
+	once sync.Once
+}
+
+func newFileWriter(output OutputConfig) *fileWriter {
+	writer := &fileWriter{
+		Logger: &lumberjack.Logger{
+			Filename:   output.Filename,
+			MaxSize:    output.MaxSize,
+			MaxAge:     output.MaxAge,
+			MaxBackups: output.MaxBackups,
+			LocalTime:  output.LocalTime,
+			Compress:   output.Compress,
+		},
+		stop: make(chan struct{}),
+	}
+	if output.RotateInterval > 0 {
+		go writer.rotatePeriodically(output.RotateInterval)
+	}
+	return writer
+}
+
+func (writer *fileWriter) rotatePeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = writer.Rotate()
+		case <-writer.stop:
+			return
+		}
+	}
+}
+
+// Sync lumberjack 沒有緩衝，直接寫入檔案
+func (writer *fileWriter) Sync() error {
+	return nil
+}
+
+// Close 停止定期輪替並關閉檔案
+func (writer *fileWriter) Close() error {
+	writer.once.Do(func() {
+		close(writer.stop)
+	})
+	return writer.Logger.Close()
+}
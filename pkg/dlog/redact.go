@@ -0,0 +1,464 @@
+package dlog
+
+import (
+	"encoding"
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultRedactMask 遮蔽之後輸出的內容
+const DefaultRedactMask = "******"
+
+// DefaultRedactKeys 沒有設定 RedactKeys 時遮蔽的欄位名稱
+var DefaultRedactKeys = []string{
+	"*password*",
+	"*passwd*",
+	"*secret*",
+	"*token*",
+	"authorization",
+	"*api_key*",
+	"*apikey*",
+	"*private_key*",
+}
+
+// redactMaxDepth 巢狀結構最多往下找幾層，避免循環參照
+const redactMaxDepth = 16
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// redactor 依照欄位名稱與 log:"secret" 標籤遮蔽欄位
+type redactor struct {
+	patterns []string
+	mask     string
+}
+
+func newRedactor(config *Config) (*redactor, error) {
+	keys := config.RedactKeys
+	if len(keys) == 0 {
+		keys = DefaultRedactKeys
+	}
+	r := &redactor{
+		patterns: make([]string, 0, len(keys)),
+		mask:     config.RedactMask,
+	}
+	if r.mask == "" {
+		r.mask = DefaultRedactMask
+	}
+	for _, key := range keys {
+		pattern := strings.ToLower(key)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, pattern)
+	}
+	return r, nil
+}
+
+// match 欄位名稱是否需要遮蔽
+func (r *redactor) match(key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range r.patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fields 返回遮蔽過的欄位，沒有需要遮蔽時返回原本的 slice
+func (r *redactor) fields(fields []zapcore.Field) []zapcore.Field {
+	var redacted []zapcore.Field
+	for i, field := range fields {
+		field, changed := r.field(field)
+		if !changed {
+			continue
+		}
+		if redacted == nil {
+			redacted = append([]zapcore.Field(nil), fields...)
+		}
+		redacted[i] = field
+	}
+	if redacted == nil {
+		return fields
+	}
+	return redacted
+}
+
+func (r *redactor) field(field zapcore.Field) (zapcore.Field, bool) {
+	switch field.Type {
+	case zapcore.SkipType, zapcore.NamespaceType, zapcore.InlineMarshalerType:
+		return field, false
+	}
+	if r.match(field.Key) {
+		return String(field.Key, r.mask), true
+	}
+	switch field.Type {
+	case zapcore.ReflectType:
+		if value, changed := r.value(reflect.ValueOf(field.Interface), 0); changed {
+			return Reflect(field.Key, value), true
+		}
+	case zapcore.ObjectMarshalerType:
+		if marshaler, ok := field.Interface.(zapcore.ObjectMarshaler); ok {
+			return Object(field.Key, redactMarshaler{redactor: r, marshaler: marshaler}), true
+		}
+	case zapcore.ArrayMarshalerType:
+		if marshaler, ok := field.Interface.(zapcore.ArrayMarshaler); ok {
+			return Array(field.Key, redactArrayMarshaler{redactor: r, marshaler: marshaler}), true
+		}
+	}
+	return field, false
+}
+
+// value 把需要遮蔽的結構轉成 map，沒有需要遮蔽時 changed 為 false
+func (r *redactor) value(v reflect.Value, depth int) (interface{}, bool) {
+	if !v.IsValid() || depth > redactMaxDepth {
+		return nil, false
+	}
+	if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) {
+		return interfaceOf(v), false
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, false
+		}
+		return r.value(v.Elem(), depth+1)
+	case reflect.Struct:
+		out := make(map[string]interface{}, v.NumField())
+		changed := r.structValue(v, out, depth)
+		return out, changed
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return interfaceOf(v), false
+		}
+		out := make(map[string]interface{}, v.Len())
+		changed := false
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			if r.match(key) {
+				out[key] = r.mask
+				changed = true
+				continue
+			}
+			value, valueChanged := r.value(iter.Value(), depth+1)
+			out[key] = value
+			changed = changed || valueChanged
+		}
+		return out, changed
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return interfaceOf(v), false
+		}
+		out := make([]interface{}, v.Len())
+		changed := false
+		for i := 0; i < v.Len(); i++ {
+			value, valueChanged := r.value(v.Index(i), depth+1)
+			out[i] = value
+			changed = changed || valueChanged
+		}
+		return out, changed
+	}
+	return interfaceOf(v), false
+}
+
+// structValue 依照 json 的規則展開結構，匿名的結構會攤平
+func (r *redactor) structValue(v reflect.Value, out map[string]interface{}, depth int) bool {
+	changed := false
+	for i := 0; i < v.NumField(); i++ {
+		structField := v.Type().Field(i)
+		name, skip := jsonName(structField)
+		if skip {
+			continue
+		}
+		fieldValue := v.Field(i)
+		if structField.Anonymous && name == "" {
+			for fieldValue.Kind() == reflect.Ptr && !fieldValue.IsNil() {
+				fieldValue = fieldValue.Elem()
+			}
+			if fieldValue.Kind() == reflect.Struct {
+				changed = r.structValue(fieldValue, out, depth+1) || changed
+				continue
+			}
+		}
+		if structField.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = structField.Name
+		}
+		if structField.Tag.Get("log") == "secret" || r.match(name) {
+			out[name] = r.mask
+			changed = true
+			continue
+		}
+		value, valueChanged := r.value(fieldValue, depth+1)
+		out[name] = value
+		changed = changed || valueChanged
+	}
+	return changed
+}
+
+// jsonName json 標籤中的名稱，標籤為 - 時略過
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	if index := strings.Index(tag, ","); index >= 0 {
+		tag = tag[:index]
+	}
+	return tag, false
+}
+
+func interfaceOf(v reflect.Value) interface{} {
+	if v.CanInterface() {
+		return v.Interface()
+	}
+	return nil
+}
+
+// redactMarshaler 遮蔽 zap.Object 輸出的欄位
+type redactMarshaler struct {
+	redactor  *redactor
+	marshaler zapcore.ObjectMarshaler
+}
+
+func (m redactMarshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	return m.marshaler.MarshalLogObject(redactEncoder{ObjectEncoder: enc, redactor: m.redactor})
+}
+
+// redactEncoder 攔下名稱需要遮蔽的欄位，每一個帶有 key 的方法都要檢查，
+// 否則以其他型別寫入的欄位不會被遮蔽
+type redactEncoder struct {
+	zapcore.ObjectEncoder
+	redactor *redactor
+}
+
+// redact 名稱需要遮蔽時寫入 mask 並返回 true
+func (enc redactEncoder) redact(key string) bool {
+	if !enc.redactor.match(key) {
+		return false
+	}
+	enc.ObjectEncoder.AddString(key, enc.redactor.mask)
+	return true
+}
+
+func (enc redactEncoder) AddArray(key string, marshaler zapcore.ArrayMarshaler) error {
+	if enc.redact(key) {
+		return nil
+	}
+	return enc.ObjectEncoder.AddArray(key, redactArrayMarshaler{redactor: enc.redactor, marshaler: marshaler})
+}
+
+func (enc redactEncoder) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
+	if enc.redact(key) {
+		return nil
+	}
+	return enc.ObjectEncoder.AddObject(key, redactMarshaler{redactor: enc.redactor, marshaler: marshaler})
+}
+
+func (enc redactEncoder) AddReflected(key string, value interface{}) error {
+	if enc.redact(key) {
+		return nil
+	}
+	if redacted, changed := enc.redactor.value(reflect.ValueOf(value), 0); changed {
+		value = redacted
+	}
+	return enc.ObjectEncoder.AddReflected(key, value)
+}
+
+func (enc redactEncoder) AddString(key, value string) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddString(key, value)
+	}
+}
+
+func (enc redactEncoder) AddByteString(key string, value []byte) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddByteString(key, value)
+	}
+}
+
+func (enc redactEncoder) AddBinary(key string, value []byte) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddBinary(key, value)
+	}
+}
+
+func (enc redactEncoder) AddBool(key string, value bool) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddBool(key, value)
+	}
+}
+
+func (enc redactEncoder) AddComplex128(key string, value complex128) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddComplex128(key, value)
+	}
+}
+
+func (enc redactEncoder) AddComplex64(key string, value complex64) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddComplex64(key, value)
+	}
+}
+
+func (enc redactEncoder) AddDuration(key string, value time.Duration) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddDuration(key, value)
+	}
+}
+
+func (enc redactEncoder) AddFloat64(key string, value float64) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddFloat64(key, value)
+	}
+}
+
+func (enc redactEncoder) AddFloat32(key string, value float32) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddFloat32(key, value)
+	}
+}
+
+func (enc redactEncoder) AddInt(key string, value int) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddInt(key, value)
+	}
+}
+
+func (enc redactEncoder) AddInt64(key string, value int64) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddInt64(key, value)
+	}
+}
+
+func (enc redactEncoder) AddInt32(key string, value int32) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddInt32(key, value)
+	}
+}
+
+func (enc redactEncoder) AddInt16(key string, value int16) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddInt16(key, value)
+	}
+}
+
+func (enc redactEncoder) AddInt8(key string, value int8) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddInt8(key, value)
+	}
+}
+
+func (enc redactEncoder) AddTime(key string, value time.Time) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddTime(key, value)
+	}
+}
+
+func (enc redactEncoder) AddUint(key string, value uint) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddUint(key, value)
+	}
+}
+
+func (enc redactEncoder) AddUint64(key string, value uint64) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddUint64(key, value)
+	}
+}
+
+func (enc redactEncoder) AddUint32(key string, value uint32) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddUint32(key, value)
+	}
+}
+
+func (enc redactEncoder) AddUint16(key string, value uint16) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddUint16(key, value)
+	}
+}
+
+func (enc redactEncoder) AddUint8(key string, value uint8) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddUint8(key, value)
+	}
+}
+
+func (enc redactEncoder) AddUintptr(key string, value uintptr) {
+	if !enc.redact(key) {
+		enc.ObjectEncoder.AddUintptr(key, value)
+	}
+}
+
+// OpenNamespace 之後的欄位仍然經過 redactEncoder，namespace 本身的名稱不需要遮蔽
+func (enc redactEncoder) OpenNamespace(key string) {
+	enc.ObjectEncoder.OpenNamespace(key)
+}
+
+// redactArrayMarshaler 遮蔽 zap.Array 中物件的欄位
+type redactArrayMarshaler struct {
+	redactor  *redactor
+	marshaler zapcore.ArrayMarshaler
+}
+
+func (m redactArrayMarshaler) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	return m.marshaler.MarshalLogArray(redactArrayEncoder{ArrayEncoder: enc, redactor: m.redactor})
+}
+
+// redactArrayEncoder 陣列的元素沒有名稱，只需要處理巢狀的物件、陣列與 reflect 的值
+type redactArrayEncoder struct {
+	zapcore.ArrayEncoder
+	redactor *redactor
+}
+
+func (enc redactArrayEncoder) AppendArray(marshaler zapcore.ArrayMarshaler) error {
+	return enc.ArrayEncoder.AppendArray(redactArrayMarshaler{redactor: enc.redactor, marshaler: marshaler})
+}
+
+func (enc redactArrayEncoder) AppendObject(marshaler zapcore.ObjectMarshaler) error {
+	return enc.ArrayEncoder.AppendObject(redactMarshaler{redactor: enc.redactor, marshaler: marshaler})
+}
+
+func (enc redactArrayEncoder) AppendReflected(value interface{}) error {
+	if redacted, changed := enc.redactor.value(reflect.ValueOf(value), 0); changed {
+		value = redacted
+	}
+	return enc.ArrayEncoder.AppendReflected(value)
+}
+
+// redactCore 寫入前遮蔽欄位，With 的欄位在 With 時就遮蔽
+type redactCore struct {
+	zapcore.Core
+	redactor *redactor
+}
+
+func (core *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{
+		Core:     core.Core.With(core.redactor.fields(fields)),
+		redactor: core.redactor,
+	}
+}
+
+func (core *redactCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if core.Enabled(entry.Level) {
+		return checked.AddCore(entry, core)
+	}
+	return checked
+}
+
+func (core *redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	writeRecord(core.Core, entry, core.redactor.fields(fields))
+	return nil
+}
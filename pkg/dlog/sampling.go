@@ -0,0 +1,196 @@
+package dlog
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// SamplingConfig 取樣的設定，每個 Tick 內相同等級與訊息的日誌，
+// 前 Initial 筆全部輸出，之後每 Thereafter 筆輸出一筆
+type SamplingConfig struct {
+	// Tick 計數的週期，預設 1s
+	Tick time.Duration
+	// Initial 每個週期一開始全部輸出的筆數
+	Initial int
+	// Thereafter 超過 Initial 之後每幾筆輸出一筆，0 表示超過之後全部丟棄
+	Thereafter int
+}
+
+func (config SamplingConfig) wrap(core zapcore.Core) zapcore.Core {
+	tick := config.Tick
+	if tick <= 0 {
+		tick = time.Second
+	}
+	return zapcore.NewSamplerWithOptions(core, tick, config.Initial, config.Thereafter)
+}
+
+// callSite Every 在每個呼叫位置的狀態
+type callSite struct {
+	lock       sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+// Every 同一個 logger（包含 With 出來的）在同一個呼叫位置每隔 interval 最多輸出一次，其餘的呼叫返回不輸出的 logger，
+// 下一次輸出時會帶上 suppressed 欄位記錄中間略過的次數，
+// 例如 logger.Every(time.Second).Warn("retry")
+func (logger *Logger) Every(interval time.Duration) *Logger {
+	pc, _, _, _ := runtime.Caller(1)
+	value, _ := logger.state.callSites.LoadOrStore(pc, &callSite{})
+	site := value.(*callSite)
+
+	now := time.Now()
+	site.lock.Lock()
+	if !site.last.IsZero() && now.Sub(site.last) < interval {
+		site.suppressed++
+		site.lock.Unlock()
+		return logger.nop()
+	}
+	suppressed := site.suppressed
+	site.last = now
+	site.suppressed = 0
+	site.lock.Unlock()
+
+	if suppressed > 0 {
+		return logger.With(Int("suppressed", suppressed))
+	}
+	return logger
+}
+
+func (logger *Logger) nop() *Logger {
+	desugarLogger := zap.NewNop()
+	return &Logger{
+		desugar: desugarLogger,
+		lv:      logger.lv,
+		sugar:   desugarLogger.Sugar(),
+		config:  logger.config,
+		state:   logger.state,
+	}
+}
+
+// dedupState 最近一筆日誌以及之後重複的次數，With 出來的 dedupCore 共用
+type dedupState struct {
+	window time.Duration
+	lock   sync.Mutex
+	key    string
+	first  time.Time
+	last   asyncRecord
+	count  int
+	timer  *time.Timer
+}
+
+// dedupCore 把連續重複的日誌合併成一筆 message repeated N times
+type dedupCore struct {
+	zapcore.Core
+	state *dedupState
+	// context With 的欄位，比對是否重複時使用
+	context string
+}
+
+func newDedupCore(core zapcore.Core, window time.Duration) *dedupCore {
+	return &dedupCore{
+		Core:  core,
+		state: &dedupState{window: window},
+	}
+}
+
+func (core *dedupCore) With(fields []zapcore.Field) zapcore.Core {
+	return &dedupCore{
+		Core:    core.Core.With(fields),
+		state:   core.state,
+		context: core.context + encodeFields(fields),
+	}
+}
+
+func (core *dedupCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if core.Enabled(entry.Level) {
+		return checked.AddCore(entry, core)
+	}
+	return checked
+}
+
+func (core *dedupCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	state := core.state
+	// Panic、Fatal 不合併
+	if entry.Level > zapcore.ErrorLevel {
+		state.flush()
+		writeRecord(core.Core, entry, fields)
+		return nil
+	}
+
+	key := fmt.Sprintf("%s|%s|%s|%s|%s", entry.Level, entry.LoggerName, entry.Message, core.context, encodeFields(fields))
+	state.lock.Lock()
+	if key == state.key && entry.Time.Sub(state.first) < state.window {
+		state.count++
+		if state.timer == nil {
+			state.timer = time.AfterFunc(state.first.Add(state.window).Sub(entry.Time), state.flush)
+		}
+		state.lock.Unlock()
+		return nil
+	}
+	repeated, ok := state.takeLocked()
+	state.key = key
+	state.first = entry.Time
+	state.last = asyncRecord{core: core.Core, entry: entry}
+	state.lock.Unlock()
+
+	if ok {
+		writeRecord(repeated.core, repeated.entry, repeated.fields)
+	}
+	writeRecord(core.Core, entry, fields)
+	return nil
+}
+
+func (core *dedupCore) Sync() error {
+	core.state.flush()
+	return core.Core.Sync()
+}
+
+// flush 輸出目前累計的重複次數，之後相同的日誌重新開始計算
+func (state *dedupState) flush() {
+	state.lock.Lock()
+	repeated, ok := state.takeLocked()
+	state.key = ""
+	state.lock.Unlock()
+	if ok {
+		writeRecord(repeated.core, repeated.entry, repeated.fields)
+	}
+}
+
+// takeLocked 取出重複次數的那筆日誌，呼叫時必須持有 lock
+func (state *dedupState) takeLocked() (asyncRecord, bool) {
+	if state.timer != nil {
+		state.timer.Stop()
+		state.timer = nil
+	}
+	count := state.count
+	state.count = 0
+	if count == 0 {
+		return asyncRecord{}, false
+	}
+	entry := state.last.entry
+	entry.Time = time.Now()
+	entry.Message = fmt.Sprintf("message repeated %d times", count)
+	return asyncRecord{
+		core:   state.last.core,
+		entry:  entry,
+		fields: []zapcore.Field{String("repeated_msg", state.last.entry.Message), Int("repeated", count)},
+	}, true
+}
+
+// encodeFields 把欄位轉成字串，用來比對是否重複
+func encodeFields(fields []zapcore.Field) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	return fmt.Sprint(enc.Fields)
+}
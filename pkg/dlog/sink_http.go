@@ -0,0 +1,100 @@
+package dlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// HTTPSinkConfig http sink 的設定
+type HTTPSinkConfig struct {
+	// URL 以 POST 送出 json 陣列
+	URL string
+	// Headers 額外的 header，例如驗證用的 token
+	Headers map[string]string
+	// Level 最低等級，nil 時為 info
+	Level *Level
+	// Timeout 每次請求的逾時，預設 10s
+	Timeout time.Duration
+	// Client 空的時候使用預設的 http.Client
+	Client *http.Client
+	BatchConfig
+}
+
+// HTTPSink 把日誌批次以 json 陣列 POST 到收集服務，
+// 連線錯誤、5xx 與 429 會重試，其餘的 4xx 直接放棄
+type HTTPSink struct {
+	*batcher
+	config HTTPSinkConfig
+	level  Level
+}
+
+// NewHTTPSink ...
+func NewHTTPSink(config HTTPSinkConfig) (*HTTPSink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("dlog: http sink without url")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{}
+	}
+	sink := &HTTPSink{config: config, level: sinkLevel(config.Level, InfoLevel)}
+	sink.batcher = newBatcher(config.BatchConfig, sink.send)
+	return sink, nil
+}
+
+// Enabled ...
+func (sink *HTTPSink) Enabled(level Level) bool {
+	return level >= sink.level
+}
+
+// Fire ...
+func (sink *HTTPSink) Fire(entry HookEntry) error {
+	return sink.push(entry)
+}
+
+func (sink *HTTPSink) send(entries []HookEntry) (int, error) {
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return 0, permanentError{err}
+	}
+	if err := postWithTimeout(sink.config.Client, sink.config.Timeout, sink.config.URL, "application/json", body, sink.config.Headers); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// postWithTimeout 送出請求並依照 status code 判斷是否需要重試
+func postWithTimeout(client *http.Client, timeout time.Duration, url, contentType string, body []byte, headers map[string]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("dlog: post %s: %s", url, resp.Status)
+	}
+	return permanentError{fmt.Errorf("dlog: post %s: %s", url, resp.Status)}
+}
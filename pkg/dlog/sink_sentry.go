@@ -0,0 +1,191 @@
+package dlog
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// SentryConfig sentry sink 的設定
+type SentryConfig struct {
+	// DSN 例如 https://public@sentry.example.com/1
+	DSN string
+	// Level 最低等級，nil 時為 error，每一筆日誌都是一個請求，不適合送出大量的 info
+	Level *Level
+	// Environment 對應 sentry 的 environment
+	Environment string
+	// Release 對應 sentry 的 release
+	Release string
+	// ServerName 預設為 os.Hostname
+	ServerName string
+	// Timeout 每次請求的逾時，預設 10s
+	Timeout time.Duration
+	// Client 空的時候使用預設的 http.Client
+	Client *http.Client
+	BatchConfig
+}
+
+// SentrySink 以 envelope 格式把日誌送到 sentry，每一筆日誌是一個 event
+type SentrySink struct {
+	*batcher
+	config   SentryConfig
+	level    Level
+	endpoint string
+	auth     string
+}
+
+// NewSentrySink ...
+func NewSentrySink(config SentryConfig) (*SentrySink, error) {
+	dsn, err := url.Parse(config.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if dsn.User == nil || dsn.User.Username() == "" {
+		return nil, fmt.Errorf("dlog: sentry dsn without public key")
+	}
+	index := strings.LastIndex(dsn.Path, "/")
+	if index < 0 || dsn.Path[index+1:] == "" {
+		return nil, fmt.Errorf("dlog: sentry dsn without project id")
+	}
+	projectID := dsn.Path[index+1:]
+
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{}
+	}
+	if config.ServerName == "" {
+		config.ServerName, _ = os.Hostname()
+	}
+	sink := &SentrySink{
+		config:   config,
+		level:    sinkLevel(config.Level, ErrorLevel),
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", dsn.Scheme, dsn.Host, dsn.Path[:index], projectID),
+		auth:     fmt.Sprintf("Sentry sentry_version=7, sentry_client=dlog/1.0, sentry_key=%s", dsn.User.Username()),
+	}
+	// 一個 envelope 只能有一個 event
+	config.BatchConfig.BatchSize = 1
+	sink.batcher = newBatcher(config.BatchConfig, sink.send)
+	return sink, nil
+}
+
+// Enabled ...
+func (sink *SentrySink) Enabled(level Level) bool {
+	return level >= sink.level
+}
+
+// Fire ...
+func (sink *SentrySink) Fire(entry HookEntry) error {
+	return sink.push(entry)
+}
+
+// sentryEvent sentry event 的欄位
+type sentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Logger      string                 `json:"logger,omitempty"`
+	Platform    string                 `json:"platform"`
+	Message     string                 `json:"message"`
+	Environment string                 `json:"environment,omitempty"`
+	Release     string                 `json:"release,omitempty"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Culprit     string                 `json:"culprit,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+func (sink *SentrySink) send(entries []HookEntry) (int, error) {
+	for sent, entry := range entries {
+		body, err := sink.envelope(entry)
+		if err != nil {
+			return sent, permanentError{err}
+		}
+		headers := map[string]string{"X-Sentry-Auth": sink.auth}
+		if err := postWithTimeout(sink.config.Client, sink.config.Timeout, sink.endpoint, "application/x-sentry-envelope", body, headers); err != nil {
+			return sent, err
+		}
+	}
+	return len(entries), nil
+}
+
+// envelope header、item header、event 各一行
+func (sink *SentrySink) envelope(entry HookEntry) ([]byte, error) {
+	eventID, err := newEventID()
+	if err != nil {
+		return nil, err
+	}
+	extra := make(map[string]interface{}, len(entry.Fields)+1)
+	for key, value := range entry.Fields {
+		extra[key] = value
+	}
+	if entry.Stack != "" {
+		extra["stack"] = entry.Stack
+	}
+	event, err := json.Marshal(sentryEvent{
+		EventID:     eventID,
+		Timestamp:   entry.Time.UTC().Format(time.RFC3339Nano),
+		Level:       sentryLevel(entry.Level),
+		Logger:      entry.Logger,
+		Platform:    "go",
+		Message:     entry.Message,
+		Environment: sink.config.Environment,
+		Release:     sink.config.Release,
+		ServerName:  sink.config.ServerName,
+		Culprit:     entry.Caller,
+		Extra:       extra,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	header, _ := json.Marshal(map[string]string{
+		"event_id": eventID,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339Nano),
+		"dsn":      sink.config.DSN,
+	})
+	buf.Write(header)
+	buf.WriteByte('\n')
+	fmt.Fprintf(&buf, `{"type":"event","length":%d}`, len(event))
+	buf.WriteByte('\n')
+	buf.Write(event)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func sentryLevel(level Level) string {
+	switch level {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warning"
+	case ErrorLevel:
+		return "error"
+	case zapcore.DPanicLevel, PanicLevel, FatalLevel:
+		return "fatal"
+	}
+	return "error"
+}
+
+// newEventID 32 個字元的 uuid，不含 -
+func newEventID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,215 @@
+package dlog
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// syslogVersion RFC5424 的版本
+const syslogVersion = 1
+
+// SyslogConfig syslog sink 的設定
+type SyslogConfig struct {
+	// Network udp、tcp、unix 或 unixgram
+	Network string
+	// Address 例如 127.0.0.1:514 或 /dev/log
+	Address string
+	// Level 最低等級，nil 時為 info
+	Level *Level
+	// Facility 預設 1（user）
+	Facility int
+	// AppName 預設為執行檔名稱
+	AppName string
+	// Hostname 預設為 os.Hostname
+	Hostname string
+	// DialTimeout 連線逾時，預設 5s
+	DialTimeout time.Duration
+	BatchConfig
+}
+
+// SyslogSink 以 RFC5424 格式送到 syslog，tcp 與 unix 使用 octet counting 分隔訊息
+type SyslogSink struct {
+	*batcher
+	config SyslogConfig
+	level  Level
+	pid    int
+	lock   sync.Mutex
+	conn   net.Conn
+}
+
+// NewSyslogSink 建立 syslog sink，連線在第一次送出時建立，斷線時會重新連線
+func NewSyslogSink(config SyslogConfig) (*SyslogSink, error) {
+	switch config.Network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "unix", "unixgram":
+	default:
+		return nil, fmt.Errorf("dlog: unknown syslog network %q", config.Network)
+	}
+	if config.Facility <= 0 {
+		config.Facility = 1
+	}
+	if config.AppName == "" {
+		config.AppName = filepath.Base(os.Args[0])
+	}
+	if config.Hostname == "" {
+		config.Hostname, _ = os.Hostname()
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = 5 * time.Second
+	}
+	sink := &SyslogSink{config: config, level: sinkLevel(config.Level, InfoLevel), pid: os.Getpid()}
+	sink.batcher = newBatcher(config.BatchConfig, sink.send)
+	return sink, nil
+}
+
+// Enabled ...
+func (sink *SyslogSink) Enabled(level Level) bool {
+	return level >= sink.level
+}
+
+// Fire ...
+func (sink *SyslogSink) Fire(entry HookEntry) error {
+	return sink.push(entry)
+}
+
+// Close 送出緩衝中的日誌並關閉連線
+func (sink *SyslogSink) Close() error {
+	err := sink.batcher.Close()
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if sink.conn != nil {
+		_ = sink.conn.Close()
+		sink.conn = nil
+	}
+	return err
+}
+
+func (sink *SyslogSink) stream() bool {
+	switch sink.config.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return true
+	}
+	return false
+}
+
+// send 逐筆寫出，寫入失敗時關閉連線，重試時重新連線
+func (sink *SyslogSink) send(entries []HookEntry) (int, error) {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	for sent, entry := range entries {
+		if sink.conn == nil {
+			conn, err := net.DialTimeout(sink.config.Network, sink.config.Address, sink.config.DialTimeout)
+			if err != nil {
+				return sent, err
+			}
+			sink.conn = conn
+		}
+		message := sink.format(entry)
+		if sink.stream() {
+			message = append([]byte(strconv.Itoa(len(message))+" "), message...)
+		}
+		if _, err := sink.conn.Write(message); err != nil {
+			_ = sink.conn.Close()
+			sink.conn = nil
+			return sent, err
+		}
+	}
+	return len(entries), nil
+}
+
+// format <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (sink *SyslogSink) format(entry HookEntry) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>%d %s %s %s %d %s ",
+		sink.config.Facility*8+syslogSeverity(entry.Level),
+		syslogVersion,
+		entry.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeader(sink.config.Hostname, 255),
+		syslogHeader(sink.config.AppName, 48),
+		sink.pid,
+		syslogHeader(entry.Logger, 32),
+	)
+	if len(entry.Fields) == 0 {
+		buf.WriteString("-")
+	} else {
+		keys := make([]string, 0, len(entry.Fields))
+		for key := range entry.Fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		// 32473 是保留給文件範例的企業編號
+		buf.WriteString("[fields@32473")
+		for _, key := range keys {
+			fmt.Fprintf(&buf, " %s=\"%s\"", syslogParamName(key), syslogParamValue(fmt.Sprint(entry.Fields[key])))
+		}
+		buf.WriteString("]")
+	}
+	buf.WriteString(" ")
+	buf.WriteString(entry.Message)
+	return buf.Bytes()
+}
+
+func syslogSeverity(level Level) int {
+	switch level {
+	case DebugLevel:
+		return 7
+	case InfoLevel:
+		return 6
+	case WarnLevel:
+		return 4
+	case ErrorLevel:
+		return 3
+	case zapcore.DPanicLevel:
+		return 2
+	case PanicLevel:
+		return 1
+	case FatalLevel:
+		return 0
+	}
+	return 5
+}
+
+// syslogHeader 標頭只能是可見的 ASCII，空的時候為 -
+func syslogHeader(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if len(value) > max {
+		value = value[:max]
+	}
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func syslogParamName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
+
+var syslogEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func syslogParamValue(value string) string {
+	return syslogEscaper.Replace(value)
+}
@@ -0,0 +1,88 @@
+package ecode
+
+import (
+	"net/http"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+)
+
+// 0 ~ 16 與 gRPC 的 codes 相同，自訂的 code 從 1000 開始，透過 Register 指定對應的 gRPC code
+const (
+	CodeOK                 int32 = 0
+	CodeCanceled           int32 = 1
+	CodeUnknown            int32 = 2
+	CodeInvalidArgument    int32 = 3
+	CodeDeadlineExceeded   int32 = 4
+	CodeNotFound           int32 = 5
+	CodeAlreadyExists      int32 = 6
+	CodePermissionDenied   int32 = 7
+	CodeResourceExhausted  int32 = 8
+	CodeFailedPrecondition int32 = 9
+	CodeAborted            int32 = 10
+	CodeOutOfRange         int32 = 11
+	CodeUnimplemented      int32 = 12
+	CodeInternal           int32 = 13
+	CodeUnavailable        int32 = 14
+	CodeDataLoss           int32 = 15
+	CodeUnauthenticated    int32 = 16
+)
+
+var registry sync.Map
+
+// Register 指定自訂 code 對應的 gRPC code，HTTP status 由 gRPC code 轉換
+func Register(code int32, grpcCode codes.Code) {
+	registry.Store(code, grpcCode)
+}
+
+// grpcCodeOf code 對應的 gRPC code，沒有註冊的自訂 code 視為 Unknown
+func grpcCodeOf(code int32) codes.Code {
+	if value, ok := registry.Load(code); ok {
+		return value.(codes.Code)
+	}
+	if code >= CodeOK && code <= CodeUnauthenticated {
+		return codes.Code(code)
+	}
+	return codes.Unknown
+}
+
+// HTTPStatusFromGRPC gRPC code 對應的 HTTP status，與 grpc-gateway 相同
+func HTTPStatusFromGRPC(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.Unknown:
+		return http.StatusInternalServerError
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Aborted:
+		return http.StatusConflict
+	case codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Internal:
+		return http.StatusInternalServerError
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DataLoss:
+		return http.StatusInternalServerError
+	}
+	return http.StatusInternalServerError
+}
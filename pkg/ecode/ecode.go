@@ -0,0 +1,198 @@
+package ecode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error 帶有 code、種類、模組與呼叫堆疊的錯誤，
+// errors.Is 以 code 與 kind 比對，方便用 New 建立的錯誤當作 sentinel
+type Error struct {
+	code    int32
+	kind    string
+	mod     string
+	message string
+	cause   error
+	stack   []uintptr
+}
+
+// New 建立錯誤並記錄呼叫堆疊
+func New(code int32, kind, message string) *Error {
+	return newError(code, kind, message, nil)
+}
+
+// Errorf 與 New 相同，message 以 fmt.Sprintf 格式化
+func Errorf(code int32, kind, format string, args ...interface{}) *Error {
+	return newError(code, kind, fmt.Sprintf(format, args...), nil)
+}
+
+// Wrap 把 err 包成 Error，err 為 nil 時返回 nil
+func Wrap(err error, code int32, kind, message string) error {
+	if err == nil {
+		return nil
+	}
+	return newError(code, kind, message, err)
+}
+
+func newError(code int32, kind, message string, cause error) *Error {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	return &Error{
+		code:    code,
+		kind:    kind,
+		message: message,
+		cause:   cause,
+		stack:   pcs[:n],
+	}
+}
+
+// WithMod 返回指定模組的副本
+func (e *Error) WithMod(mod string) *Error {
+	clone := *e
+	clone.mod = mod
+	return &clone
+}
+
+// Wrap 以這個錯誤的 code、kind、模組與訊息包住 cause，並重新記錄呼叫堆疊，
+// 用來從 sentinel 錯誤產生帶有原因的錯誤
+func (e *Error) Wrap(cause error) *Error {
+	err := newError(e.code, e.kind, e.message, cause)
+	err.mod = e.mod
+	return err
+}
+
+// Code ...
+func (e *Error) Code() int32 {
+	return e.code
+}
+
+// Kind ...
+func (e *Error) Kind() string {
+	return e.kind
+}
+
+// Mod ...
+func (e *Error) Mod() string {
+	return e.mod
+}
+
+// Message ...
+func (e *Error) Message() string {
+	return e.message
+}
+
+// Cause 被包住的錯誤
+func (e *Error) Cause() error {
+	return e.cause
+}
+
+// Unwrap 讓 errors.Is 與 errors.As 可以往下找
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+func (e *Error) Error() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "code = %d", e.code)
+	if e.kind != "" {
+		fmt.Fprintf(&builder, ", kind = %s", e.kind)
+	}
+	if e.mod != "" {
+		fmt.Fprintf(&builder, ", mod = %s", e.mod)
+	}
+	if e.message != "" {
+		fmt.Fprintf(&builder, ", msg = %s", e.message)
+	}
+	if e.cause != nil {
+		fmt.Fprintf(&builder, ": %v", e.cause)
+	}
+	return builder.String()
+}
+
+// Is code 相同，且 target 沒有指定 kind 或 kind 相同時視為同一個錯誤
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return e.code == t.code && (t.kind == "" || e.kind == t.kind)
+}
+
+// Stack 建立錯誤時的呼叫堆疊
+func (e *Error) Stack() string {
+	var builder strings.Builder
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&builder, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return builder.String()
+}
+
+// GRPCStatus 讓 status.FromError 與 status.Code 可以取得對應的狀態
+func (e *Error) GRPCStatus() *status.Status {
+	message := e.message
+	if e.cause != nil {
+		if message != "" {
+			message += ": "
+		}
+		message += e.cause.Error()
+	}
+	return status.New(grpcCodeOf(e.code), message)
+}
+
+// HTTPStatus 對應的 HTTP status
+func (e *Error) HTTPStatus() int {
+	return HTTPStatusFromGRPC(grpcCodeOf(e.code))
+}
+
+// FromError 取出 err 中的 Error，沒有時返回 nil
+func FromError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return nil
+}
+
+// CodeOf err 的 code，nil 為 CodeOK，不是 Error 的錯誤依照 GRPCCode 轉換
+func CodeOf(err error) int32 {
+	if e := FromError(err); e != nil {
+		return e.code
+	}
+	return int32(GRPCCode(err))
+}
+
+// GRPCCode err 對應的 gRPC code，context 的錯誤會轉成 Canceled 與 DeadlineExceeded
+func GRPCCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if e := FromError(err); e != nil {
+		return grpcCodeOf(e.code)
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	return codes.Unknown
+}
+
+// HTTPStatus err 對應的 HTTP status
+func HTTPStatus(err error) int {
+	return HTTPStatusFromGRPC(GRPCCode(err))
+}
@@ -0,0 +1,62 @@
+package ecode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errUserNotFound = New(CodeNotFound, "user", "user not found")
+
+func findUser() error {
+	return fmt.Errorf("find user: %w", errUserNotFound.Wrap(errors.New("no rows")))
+}
+
+func Test_Error(t *testing.T) {
+	err := findUser()
+	assert.True(t, errors.Is(err, errUserNotFound))
+	assert.True(t, errors.Is(err, New(CodeNotFound, "", "")))
+	assert.False(t, errors.Is(err, New(CodeNotFound, "order", "")))
+	assert.False(t, errors.Is(err, New(CodeInternal, "user", "")))
+
+	e := FromError(err)
+	assert.NotNil(t, e)
+	assert.Equal(t, CodeNotFound, e.Code())
+	assert.Equal(t, "user", e.Kind())
+	assert.Equal(t, "no rows", e.Cause().Error())
+	assert.Equal(t, "code = 5, kind = user, msg = user not found: no rows", e.Error())
+	assert.Contains(t, e.Stack(), "findUser")
+	assert.False(t, strings.Contains(errUserNotFound.Stack(), "findUser"))
+
+	assert.Equal(t, "client.etcd", errUserNotFound.WithMod(ModClientETCD).Mod())
+	assert.Equal(t, "", errUserNotFound.Mod())
+	assert.Nil(t, Wrap(nil, CodeInternal, ErrKindAny, "nothing"))
+}
+
+func Test_Status(t *testing.T) {
+	err := findUser()
+	assert.Equal(t, codes.NotFound, GRPCCode(err))
+	assert.Equal(t, http.StatusNotFound, HTTPStatus(err))
+	assert.Equal(t, codes.NotFound, status.Code(FromError(err)))
+	assert.Equal(t, "user not found: no rows", FromError(err).GRPCStatus().Message())
+
+	Register(1001, codes.ResourceExhausted)
+	t.Cleanup(func() { registry.Delete(int32(1001)) })
+	quota := New(1001, "quota", "too many requests")
+	assert.Equal(t, int32(1001), CodeOf(quota))
+	assert.Equal(t, http.StatusTooManyRequests, quota.HTTPStatus())
+	assert.Equal(t, codes.Unknown, GRPCCode(New(1002, "", "")))
+
+	assert.Equal(t, codes.OK, GRPCCode(nil))
+	assert.Equal(t, codes.DeadlineExceeded, GRPCCode(fmt.Errorf("call: %w", context.DeadlineExceeded)))
+	assert.Equal(t, int32(CodeCanceled), CodeOf(context.Canceled))
+	assert.Equal(t, codes.Unavailable, GRPCCode(status.Error(codes.Unavailable, "down")))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatus(errors.New("plain")))
+}
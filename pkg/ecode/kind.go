@@ -0,0 +1,22 @@
+package ecode
+
+// 錯誤的種類，輸出在日誌的 errKind 欄位
+const (
+	ErrKindAny                = "any"
+	ErrKindUnmarshalConfigErr = "unmarshal config err"
+	ErrKindRegisterErr        = "register err"
+	ErrKindUriErr             = "uri err"
+	ErrKindRequestErr         = "request err"
+	ErrKindListenErr          = "listen err"
+	ErrKindTimeoutErr         = "timeout err"
+)
+
+// 發生錯誤的模組，輸出在日誌的 mod 欄位
+const (
+	ModClientETCD = "client.etcd"
+)
+
+// 常用的錯誤訊息
+const (
+	MsgWatchRequestErr = "watch request err"
+)
@@ -0,0 +1,330 @@
+package worker_pool
+
+import (
+	"io/ioutil"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digital-monster-1997/digicore/pkg/dlog"
+)
+
+// AutoscaleSignal 一次評估時收集到的指標
+type AutoscaleSignal struct {
+	// Capacity 目前的容量
+	Capacity int
+	// Min、Max 容量的範圍
+	Min, Max int
+	// Running 正在執行中的 worker 數量，包含閒置的 worker
+	Running int
+	// Idle 閒置的 worker 數量
+	Idle int
+	// Blocking 阻塞等待 worker 的提交
+	Blocking int
+	// Queued 排隊模式中排隊的任務
+	Queued int
+	// Utilization 執行任務中的 worker 佔容量的比例
+	Utilization float64
+	// WaitTime 上一次評估之後開始執行的任務的平均等待時間
+	WaitTime time.Duration
+	// CPULoad 平均到每個 CPU 的負載
+	CPULoad float64
+}
+
+// ScalePolicy 依照指標決定新的容量與原因，返回值會被限制在 Min 與 Max 之間
+type ScalePolicy interface {
+	Decide(signal AutoscaleSignal) (capacity int, reason string)
+}
+
+// ThresholdPolicy 預設的策略，等待時間過長或使用率過高時擴充，使用率低且沒有等待時縮減，
+// CPU 負載過高時不再擴充，避免更多的 goroutine 互相搶 CPU
+type ThresholdPolicy struct {
+	// TargetWait 平均等待時間超過時擴充，預設 10ms
+	TargetWait time.Duration
+	// HighUtilization 使用率超過時擴充，預設 0.8
+	HighUtilization float64
+	// LowUtilization 使用率低於時縮減，預設 0.3
+	LowUtilization float64
+	// MaxCPULoad CPU 負載超過時不擴充，預設 0.9
+	MaxCPULoad float64
+	// ScaleUpFactor 每次擴充的倍數，預設 1.5
+	ScaleUpFactor float64
+	// ScaleDownFactor 每次縮減的倍數，預設 0.75
+	ScaleDownFactor float64
+}
+
+// Decide ...
+func (policy ThresholdPolicy) Decide(signal AutoscaleSignal) (int, string) {
+	if policy.TargetWait <= 0 {
+		policy.TargetWait = 10 * time.Millisecond
+	}
+	if policy.HighUtilization <= 0 {
+		policy.HighUtilization = 0.8
+	}
+	if policy.LowUtilization <= 0 {
+		policy.LowUtilization = 0.3
+	}
+	if policy.MaxCPULoad <= 0 {
+		policy.MaxCPULoad = 0.9
+	}
+	if policy.ScaleUpFactor <= 1 {
+		policy.ScaleUpFactor = 1.5
+	}
+	if policy.ScaleDownFactor <= 0 || policy.ScaleDownFactor >= 1 {
+		policy.ScaleDownFactor = 0.75
+	}
+
+	current := signal.Capacity
+	var reason string
+	switch {
+	case signal.WaitTime > policy.TargetWait:
+		reason = "wait time above target"
+	case signal.Blocking+signal.Queued > 0:
+		reason = "tasks waiting for workers"
+	case signal.Utilization >= policy.HighUtilization:
+		reason = "utilization above high watermark"
+	}
+	if reason != "" {
+		if signal.CPULoad >= policy.MaxCPULoad {
+			return current, "cpu load above limit"
+		}
+		next := int(math.Ceil(float64(current) * policy.ScaleUpFactor))
+		if next <= current {
+			next = current + 1
+		}
+		return next, reason
+	}
+	if signal.Utilization <= policy.LowUtilization {
+		next := int(math.Floor(float64(current) * policy.ScaleDownFactor))
+		if next >= current {
+			next = current - 1
+		}
+		return next, "utilization below low watermark"
+	}
+	return current, "within watermarks"
+}
+
+// AutoscaleConfig 自動調整容量的設定
+type AutoscaleConfig struct {
+	// Min 最小容量，預設 1
+	Min int
+	// Max 最大容量，必須大於等於 Min
+	Max int
+	// Interval 評估的間隔，預設 1s
+	Interval time.Duration
+	// ScaleUpCooldown 上一次調整之後多久才能擴充，預設與 Interval 相同
+	ScaleUpCooldown time.Duration
+	// ScaleDownCooldown 上一次調整之後多久才能縮減，預設 30s，比擴充長以避免來回震盪
+	ScaleDownCooldown time.Duration
+	// Policy 預設為 ThresholdPolicy{}
+	Policy ScalePolicy
+	// CPULoad 返回每個 CPU 的平均負載，預設讀取 /proc/loadavg，無法讀取時為 0
+	CPULoad func() float64
+	// Logger 記錄每次的決定，預設為 dlog.DigitCore
+	Logger *dlog.Logger
+}
+
+// AutoscaleDecision 一次評估的結果
+type AutoscaleDecision struct {
+	Signal AutoscaleSignal
+	// From、To 調整前後的容量，沒有調整時相同
+	From, To int
+	// Reason 策略給的原因，冷卻中時為 cooldown
+	Reason string
+}
+
+// Autoscaler 定期依照 ScalePolicy 以 ChangeSize 調整池子的容量
+type Autoscaler struct {
+	pool   *Pool
+	config AutoscaleConfig
+	logger *dlog.Logger
+	now    func() time.Time
+
+	lock       sync.Mutex
+	lastChange time.Time
+	lastWait   Histogram
+
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewAutoscaler 建立 autoscaler，池子必須有固定的容量而且不是 PreAlloc 模式，
+// 建立時不會改變容量，呼叫 Start 之後才會調整
+func NewAutoscaler(pool *Pool, config AutoscaleConfig) (*Autoscaler, error) {
+	if pool.Cap() == -1 || pool.options.PreAlloc {
+		return nil, ErrAutoscaleUnsupported
+	}
+	if config.Min <= 0 {
+		config.Min = 1
+	}
+	if config.Max < config.Min {
+		return nil, ErrInvalidAutoscaleRange
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.ScaleUpCooldown <= 0 {
+		config.ScaleUpCooldown = config.Interval
+	}
+	if config.ScaleDownCooldown <= 0 {
+		config.ScaleDownCooldown = 30 * time.Second
+	}
+	if config.Policy == nil {
+		config.Policy = ThresholdPolicy{}
+	}
+	if config.CPULoad == nil {
+		config.CPULoad = loadAverage
+	}
+	if config.Logger == nil {
+		config.Logger = dlog.DigitCore
+	}
+	a := &Autoscaler{
+		pool:     pool,
+		config:   config,
+		logger:   config.Logger.With(dlog.FieldMod("worker_pool.autoscaler")),
+		now:      time.Now,
+		lastWait: pool.Stats().WaitTime,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	return a, nil
+}
+
+// Start 立刻評估一次，把容量限制在 Min 與 Max 之間，之後在背景定期評估，直到 Stop
+func (a *Autoscaler) Start() {
+	a.startOnce.Do(func() {
+		if !a.pool.IsClosed() {
+			a.Evaluate()
+		}
+		go a.run()
+	})
+}
+
+// Stop 停止背景的評估並等待它結束
+func (a *Autoscaler) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stop)
+	})
+	// 沒有 Start 過時直接標記結束，之後的 Start 也不會再啟動
+	a.startOnce.Do(func() {
+		close(a.done)
+	})
+	<-a.done
+}
+
+func (a *Autoscaler) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !a.pool.IsClosed() {
+				a.Evaluate()
+			}
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// Evaluate 評估一次並在需要時調整容量，Start 會定期呼叫
+func (a *Autoscaler) Evaluate() AutoscaleDecision {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	signal := a.signal()
+	decision := AutoscaleDecision{Signal: signal, From: signal.Capacity}
+	now := a.now()
+	// 容量在範圍之外，例如還沒評估過或被直接 ChangeSize，不經過策略與冷卻直接限制回範圍內
+	inRange := clamp(signal.Capacity, a.config.Min, a.config.Max)
+	if inRange != signal.Capacity {
+		decision.To, decision.Reason = inRange, "capacity out of range"
+	} else {
+		to, reason := a.config.Policy.Decide(signal)
+		decision.To, decision.Reason = clamp(to, a.config.Min, a.config.Max), reason
+	}
+	if inRange == signal.Capacity && decision.To != decision.From {
+		cooldown := a.config.ScaleDownCooldown
+		if decision.To > decision.From {
+			cooldown = a.config.ScaleUpCooldown
+		}
+		if !a.lastChange.IsZero() && now.Sub(a.lastChange) < cooldown {
+			decision.To, decision.Reason = decision.From, "cooldown"
+		}
+	}
+
+	fields := []dlog.Field{
+		dlog.Int("from", decision.From),
+		dlog.Int("to", decision.To),
+		dlog.String("reason", decision.Reason),
+		dlog.Float64("utilization", signal.Utilization),
+		dlog.Duration("wait", signal.WaitTime),
+		dlog.Int("blocking", signal.Blocking),
+		dlog.Int("queued", signal.Queued),
+		dlog.Float64("cpu", signal.CPULoad),
+	}
+	if decision.To == decision.From {
+		a.logger.Debug("autoscale hold", fields...)
+		return decision
+	}
+	a.pool.ChangeSize(decision.To)
+	a.lastChange = now
+	a.logger.Info("autoscale resize", fields...)
+	return decision
+}
+
+// signal 收集指標，WaitTime 為與上一次評估之間的平均
+func (a *Autoscaler) signal() AutoscaleSignal {
+	stats := a.pool.Stats()
+	signal := AutoscaleSignal{
+		Capacity: stats.Capacity,
+		Min:      a.config.Min,
+		Max:      a.config.Max,
+		Running:  stats.Running,
+		Idle:     stats.Idle,
+		Blocking: stats.Blocking,
+		Queued:   stats.Queued,
+		CPULoad:  a.config.CPULoad(),
+	}
+	if stats.Capacity > 0 {
+		signal.Utilization = float64(stats.Running-stats.Idle) / float64(stats.Capacity)
+	}
+	if count := stats.WaitTime.Count - a.lastWait.Count; count > 0 {
+		signal.WaitTime = (stats.WaitTime.Sum - a.lastWait.Sum) / time.Duration(count)
+	}
+	a.lastWait = stats.WaitTime
+	return signal
+}
+
+func clamp(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+// loadAverage 讀取 linux 一分鐘的平均負載並除以 CPU 數量
+func loadAverage() float64 {
+	content, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return 0
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	return load / float64(runtime.NumCPU())
+}
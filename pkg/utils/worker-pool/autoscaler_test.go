@@ -0,0 +1,132 @@
+package worker_pool
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digital-monster-1997/digicore/pkg/dlog"
+	"github.com/digital-monster-1997/digicore/pkg/dlog/dlogtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type policyFunc func(signal AutoscaleSignal) (int, string)
+
+func (fn policyFunc) Decide(signal AutoscaleSignal) (int, string) {
+	return fn(signal)
+}
+
+func TestAutoscaler(t *testing.T) {
+	p, _ := NewPool(4)
+	defer p.Release()
+	logger, logs := dlogtest.New()
+	cpu := 0.1
+	a, err := NewAutoscaler(p, AutoscaleConfig{
+		Min:               2,
+		Max:               8,
+		Interval:          time.Hour,
+		ScaleUpCooldown:   time.Minute,
+		ScaleDownCooldown: 5 * time.Minute,
+		CPULoad:           func() float64 { return cpu },
+		Logger:            logger,
+	})
+	assert.Nil(t, err)
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	// 所有 worker 都在忙，擴充 1.5 倍
+	var wg sync.WaitGroup
+	block := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		assert.Nil(t, p.Submit(func() { <-block; wg.Done() }))
+	}
+	decision := a.Evaluate()
+	assert.Equal(t, 4, decision.From)
+	assert.Equal(t, 6, decision.To)
+	assert.Equal(t, "utilization above high watermark", decision.Reason)
+	assert.Equal(t, 6, p.Cap())
+	logs.AssertLogged(t, dlog.InfoLevel, "autoscale resize")
+	assert.Equal(t, 1, logs.FilterMod("worker_pool.autoscaler").FilterMessage("autoscale resize").Len())
+
+	// 冷卻中不調整
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		assert.Nil(t, p.Submit(func() { <-block; wg.Done() }))
+	}
+	decision = a.Evaluate()
+	assert.Equal(t, "cooldown", decision.Reason)
+	assert.Equal(t, 6, p.Cap())
+
+	// CPU 負載過高時不擴充
+	now = now.Add(2 * time.Minute)
+	cpu = 0.95
+	decision = a.Evaluate()
+	assert.Equal(t, "cpu load above limit", decision.Reason)
+	assert.Equal(t, 6, decision.To)
+
+	// 擴充不超過 Max
+	cpu = 0.1
+	decision = a.Evaluate()
+	assert.Equal(t, 8, decision.To)
+	assert.Equal(t, 8, p.Cap())
+
+	// 閒置之後縮減，縮減的冷卻比較長
+	close(block)
+	wg.Wait()
+	for p.Stats().Idle != p.Running() {
+		time.Sleep(time.Millisecond)
+	}
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, "cooldown", a.Evaluate().Reason)
+	now = now.Add(5 * time.Minute)
+	decision = a.Evaluate()
+	assert.Equal(t, "utilization below low watermark", decision.Reason)
+	assert.Equal(t, 6, p.Cap())
+	logs.AssertLogged(t, dlog.DebugLevel, "autoscale hold")
+
+	// 自訂策略，結果限制在 Min 與 Max 之間
+	a.config.Policy = policyFunc(func(signal AutoscaleSignal) (int, string) {
+		assert.Equal(t, 2, signal.Min)
+		return 0, "custom"
+	})
+	now = now.Add(time.Hour)
+	decision = a.Evaluate()
+	assert.Equal(t, 2, decision.To)
+	assert.Equal(t, 2, p.Cap())
+}
+
+func TestAutoscalerLifecycle(t *testing.T) {
+	unbounded, _ := NewPool(0)
+	defer unbounded.Release()
+	_, err := NewAutoscaler(unbounded, AutoscaleConfig{Max: 10})
+	assert.Equal(t, ErrAutoscaleUnsupported, err)
+
+	p, _ := NewPool(20)
+	defer p.Release()
+	_, err = NewAutoscaler(p, AutoscaleConfig{Min: 5, Max: 2})
+	assert.Equal(t, ErrInvalidAutoscaleRange, err)
+
+	// 建立時不改變容量，Start 時限制在範圍內並記錄，不受冷卻影響
+	logger, logs := dlogtest.New()
+	a, err := NewAutoscaler(p, AutoscaleConfig{Min: 1, Max: 10, Interval: 5 * time.Millisecond, Logger: logger})
+	assert.Nil(t, err)
+	assert.Equal(t, 20, p.Cap())
+	a.lastChange = time.Now()
+
+	a.Start()
+	a.Start()
+	assert.Equal(t, 10, p.Cap())
+	logs.AssertLogged(t, dlog.InfoLevel, "autoscale resize",
+		dlog.Int("from", 20), dlog.Int("to", 10), dlog.String("reason", "capacity out of range"))
+	for logs.Len() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	a.Stop()
+	a.Stop()
+
+	idle, err := NewAutoscaler(p, AutoscaleConfig{Max: 10})
+	assert.Nil(t, err)
+	idle.Stop()
+	idle.Start()
+}
@@ -99,4 +99,35 @@ func BenchmarkAntsPoolThroughput(b *testing.B) {
 		}
 	}
 	b.StopTimer()
-}
\ No newline at end of file
+}
+
+func BenchmarkAntsPoolWithFunc(b *testing.B) {
+	var wg sync.WaitGroup
+	p, _ := NewPoolWithFunc(BenchAntsSize, func(i interface{}) {
+		demoPoolFunc(i)
+		wg.Done()
+	}, WithExpiryDuration(DefaultExpiredTime))
+	defer p.Release()
+
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(RunTimes)
+		for j := 0; j < RunTimes; j++ {
+			_ = p.Invoke(BenchParam)
+		}
+		wg.Wait()
+	}
+	b.StopTimer()
+}
+
+func BenchmarkAntsPoolWithFuncThroughput(b *testing.B) {
+	p, _ := NewPoolWithFunc(BenchAntsSize, demoPoolFunc, WithExpiryDuration(DefaultExpiredTime))
+	defer p.Release()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < RunTimes; j++ {
+			_ = p.Invoke(BenchParam)
+		}
+	}
+	b.StopTimer()
+}
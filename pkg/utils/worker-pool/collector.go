@@ -0,0 +1,83 @@
+package worker_pool
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector 以 prometheus 的格式匯出 Pool.Stats，name 會成為每個指標的 pool 標籤
+type Collector struct {
+	pool *Pool
+
+	capacity  *prometheus.Desc
+	running   *prometheus.Desc
+	idle      *prometheus.Desc
+	blocking  *prometheus.Desc
+	queued    *prometheus.Desc
+	submitted *prometheus.Desc
+	completed *prometheus.Desc
+	rejected  *prometheus.Desc
+	panicked  *prometheus.Desc
+	waitTime  *prometheus.Desc
+	execTime  *prometheus.Desc
+}
+
+// NewCollector 建立 pool 的 prometheus collector，使用 prometheus.MustRegister 註冊
+func NewCollector(name string, pool *Pool) *Collector {
+	labels := prometheus.Labels{"pool": name}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("worker_pool", "", metric), help, nil, labels)
+	}
+	return &Collector{
+		pool:      pool,
+		capacity:  desc("capacity", "Capacity of the pool, -1 means unlimited."),
+		running:   desc("running_workers", "Number of running workers."),
+		idle:      desc("idle_workers", "Number of idle workers waiting for tasks."),
+		blocking:  desc("blocking_submitters", "Number of submitters blocked waiting for a worker."),
+		queued:    desc("queued_tasks", "Number of tasks waiting in queues."),
+		submitted: desc("submitted_tasks_total", "Total number of tasks handed to workers."),
+		completed: desc("completed_tasks_total", "Total number of tasks returned normally."),
+		rejected:  desc("rejected_tasks_total", "Total number of rejected tasks."),
+		panicked:  desc("panicked_tasks_total", "Total number of tasks that panicked."),
+		waitTime:  desc("task_wait_seconds", "Time from submit to the start of execution."),
+		execTime:  desc("task_exec_seconds", "Time spent executing tasks."),
+	}
+}
+
+// Describe ...
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		c.capacity, c.running, c.idle, c.blocking, c.queued,
+		c.submitted, c.completed, c.rejected, c.panicked, c.waitTime, c.execTime,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect ...
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.pool.Stats()
+	gauge := func(desc *prometheus.Desc, value int) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(value))
+	}
+	counter := func(desc *prometheus.Desc, value uint64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value))
+	}
+	histogram := func(desc *prometheus.Desc, h Histogram) {
+		buckets := make(map[float64]uint64, len(h.Buckets))
+		for _, bucket := range h.Buckets {
+			buckets[bucket.UpperBound] = bucket.Count
+		}
+		ch <- prometheus.MustNewConstHistogram(desc, h.Count, h.Sum.Seconds(), buckets)
+	}
+	gauge(c.capacity, stats.Capacity)
+	gauge(c.running, stats.Running)
+	gauge(c.idle, stats.Idle)
+	gauge(c.blocking, stats.Blocking)
+	gauge(c.queued, stats.Queued)
+	counter(c.submitted, stats.Submitted)
+	counter(c.completed, stats.Completed)
+	counter(c.rejected, stats.Rejected)
+	counter(c.panicked, stats.Panicked)
+	histogram(c.waitTime, stats.WaitTime)
+	histogram(c.execTime, stats.ExecTime)
+}
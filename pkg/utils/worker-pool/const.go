@@ -19,6 +19,24 @@ var (
 	ErrInvalidPoolExpiry = errors.New("invalid expiry for pool")
 
 	ErrInvalidPreAllocSize = errors.New("can not set up a negative capacity under PreAlloc mode")
+	// ErrLackPoolFunc NewPoolWithFunc 沒有傳入處理函數
+	ErrLackPoolFunc = errors.New("must provide function for pool")
+	// ErrFutureCanceled Future 在任務完成之前被取消
+	ErrFutureCanceled = errors.New("future is canceled")
+	// ErrQueueNotEnabled 沒有設定 Queues 時呼叫 Enqueue
+	ErrQueueNotEnabled = errors.New("queued mode is not enabled")
+	// ErrUnknownQueue Enqueue 的 key 沒有對應的隊列，也沒有設定 DefaultQueue
+	ErrUnknownQueue = errors.New("unknown queue")
+	// ErrQueueFull 隊列已經達到 MaxLength，任務被拒絕
+	ErrQueueFull = errors.New("queue is full")
+	// ErrAutoscaleUnsupported 容量不限制或 PreAlloc 模式的池子無法調整容量
+	ErrAutoscaleUnsupported = errors.New("autoscale requires a bounded pool without PreAlloc")
+	// ErrInvalidAutoscaleRange AutoscaleConfig 的 Max 小於 Min
+	ErrInvalidAutoscaleRange = errors.New("invalid autoscale capacity range")
+	// ErrSchedulerStopped Scheduler 已經停止，不再接受排程
+	ErrSchedulerStopped = errors.New("scheduler has been stopped")
+	// ErrInvalidInterval Every 的間隔必須大於 0
+	ErrInvalidInterval = errors.New("interval must be positive")
 	workerChanCap = func() int {
 		// Use blocking channel if GOMAXPROCS=1.
 		// This switches context from sender to receiver immediately,
@@ -39,6 +57,9 @@ const (
 
 	// CLOSED 池子目前的狀態是關起來的
 	CLOSED
+
+	// DRAINING 池子正在 Shutdown，不接受新的任務
+	DRAINING
 )
 
 const (
@@ -0,0 +1,222 @@
+package worker_pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultQueue Queues 中以這個 key 設定沒有列出的隊列，例如讓每個租戶有自己的隊列
+const DefaultQueue = "*"
+
+// QueueConfig 排隊模式中一個隊列的設定
+type QueueConfig struct {
+	// Weight 權重，隊列都有任務時，分到的 worker 與權重成正比，預設 1
+	Weight int
+	// MaxLength 排隊中的任務上限，超過時 Enqueue 返回 ErrQueueFull，0 表示不限制
+	MaxLength int
+}
+
+// Enqueue 把任務放進 key 對應的隊列，由背景的 goroutine 以加權公平排隊（WFQ）的順序交給 worker，
+// 權重低的隊列即使堆積大量任務，也不會讓權重高的隊列一直等待
+func (p *Pool) Enqueue(key string, task func()) error {
+	if p.queue == nil {
+		return ErrQueueNotEnabled
+	}
+	if !p.accepting() {
+		return ErrPoolClosed
+	}
+	p.addInflight(1)
+	if err := p.queue.push(key, task); err != nil {
+		p.addInflight(-1)
+		atomic.AddUint64(&p.stats.rejected, 1)
+		return err
+	}
+	return nil
+}
+
+// QueueLen 返回 key 對應的隊列中排隊的任務數量
+func (p *Pool) QueueLen(key string) int {
+	if p.queue == nil {
+		return 0
+	}
+	return p.queue.len(key)
+}
+
+// dispatch 依序取出排隊中的任務提交給 worker，隊列關閉或重新開啟之後結束
+func (p *Pool) dispatch(q *fairQueue, generation int) {
+	for {
+		next, ok := q.pop(generation)
+		if !ok {
+			return
+		}
+		// 排隊的任務在 Enqueue 時已經計入 inflight，等待時間包含排隊的時間，
+		// 已經接受的任務不受 NonBlocking 與 MaxBlockingTasks 影響，一直等到有 worker，
+		// 只有池子關閉時才會失敗，Release 會同時關閉隊列
+		if err := p.deliver(context.Background(), next.info, next.task, true); err != nil {
+			p.addInflight(-1)
+		}
+	}
+}
+
+// queuedTask 排隊中的任務，finish 為虛擬完成時間
+type queuedTask struct {
+	task   func()
+	finish float64
+	info   taskInfo
+}
+
+// taskQueue 一個隊列
+type taskQueue struct {
+	config QueueConfig
+	tasks  []queuedTask
+	// lastFinish 最後一個進入隊列的任務的虛擬完成時間
+	lastFinish float64
+	// dynamic 以 DefaultQueue 建立的隊列，清空之後移除
+	dynamic bool
+}
+
+// fairQueue 加權公平排隊，每個任務的虛擬完成時間為
+// max(目前的虛擬時間, 同一隊列上一個任務的完成時間) + 1/權重，每次取出完成時間最小的任務
+type fairQueue struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	configs map[string]QueueConfig
+	queues  map[string]*taskQueue
+	vtime   float64
+	length  int
+	closed  bool
+	// generation 每次 reopen 加一，讓舊的 dispatch 結束
+	generation int
+}
+
+func newFairQueue(configs map[string]QueueConfig) *fairQueue {
+	q := &fairQueue{
+		configs: make(map[string]QueueConfig, len(configs)),
+		queues:  make(map[string]*taskQueue, len(configs)),
+	}
+	q.cond = sync.NewCond(&q.lock)
+	for key, config := range configs {
+		if config.Weight <= 0 {
+			config.Weight = 1
+		}
+		q.configs[key] = config
+		if key != DefaultQueue {
+			q.queues[key] = &taskQueue{config: config}
+		}
+	}
+	return q
+}
+
+func (q *fairQueue) push(key string, task func()) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return ErrPoolClosed
+	}
+	tq, ok := q.queues[key]
+	if !ok {
+		config, ok := q.configs[DefaultQueue]
+		if !ok {
+			return ErrUnknownQueue
+		}
+		tq = &taskQueue{config: config, dynamic: true}
+		q.queues[key] = tq
+	}
+	if tq.config.MaxLength > 0 && len(tq.tasks) >= tq.config.MaxLength {
+		return ErrQueueFull
+	}
+	start := q.vtime
+	if tq.lastFinish > start {
+		start = tq.lastFinish
+	}
+	tq.lastFinish = start + 1/float64(tq.config.Weight)
+	tq.tasks = append(tq.tasks, queuedTask{task: task, finish: tq.lastFinish, info: newTaskInfo(task)})
+	q.length++
+	q.cond.Signal()
+	return nil
+}
+
+// pop 取出虛擬完成時間最小的任務，沒有任務時阻塞，關閉後返回 false
+func (q *fairQueue) pop(generation int) (queuedTask, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for q.length == 0 && !q.closed && q.generation == generation {
+		q.cond.Wait()
+	}
+	if q.closed || q.generation != generation {
+		return queuedTask{}, false
+	}
+	var (
+		minKey   string
+		minQueue *taskQueue
+	)
+	for key, tq := range q.queues {
+		if len(tq.tasks) == 0 {
+			continue
+		}
+		if minQueue == nil || tq.tasks[0].finish < minQueue.tasks[0].finish {
+			minKey, minQueue = key, tq
+		}
+	}
+	next := minQueue.tasks[0]
+	minQueue.tasks[0] = queuedTask{}
+	minQueue.tasks = minQueue.tasks[1:]
+	q.length--
+	q.vtime = next.finish
+	if len(minQueue.tasks) == 0 && minQueue.dynamic {
+		delete(q.queues, minKey)
+	}
+	return next, true
+}
+
+func (q *fairQueue) len(key string) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if tq, ok := q.queues[key]; ok {
+		return len(tq.tasks)
+	}
+	return 0
+}
+
+// size 所有隊列中排隊的任務數量
+func (q *fairQueue) size() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.length
+}
+
+// close 丟棄排隊中的任務並喚醒 dispatch，返回丟棄的數量
+func (q *fairQueue) close() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return 0
+	}
+	q.closed = true
+	dropped := q.length
+	for key, tq := range q.queues {
+		if tq.dynamic {
+			delete(q.queues, key)
+			continue
+		}
+		tq.tasks = nil
+	}
+	q.length = 0
+	q.cond.Broadcast()
+	return dropped
+}
+
+// reopen Reboot 時重新接受任務，返回新的 generation
+func (q *fairQueue) reopen() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.generation++
+	q.cond.Broadcast()
+	q.closed = false
+	q.vtime = 0
+	for _, tq := range q.queues {
+		tq.lastFinish = 0
+	}
+	return q.generation
+}
@@ -0,0 +1,126 @@
+package worker_pool
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFairQueue(t *testing.T) {
+	p, _ := NewPool(1, WithQueues(map[string]QueueConfig{
+		"interactive": {Weight: 4},
+		"batch":       {Weight: 1, MaxLength: 20},
+	}))
+	defer p.Release()
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	order := make([]string, 0)
+	record := func(name string) func() {
+		return func() {
+			lock.Lock()
+			order = append(order, name)
+			lock.Unlock()
+			wg.Done()
+		}
+	}
+
+	// 先佔住唯一的 worker，讓任務都在隊列中排隊
+	block := make(chan struct{})
+	assert.Nil(t, p.Submit(func() { <-block }))
+	wg.Add(25)
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, p.Enqueue("batch", record("batch")))
+	}
+	assert.Equal(t, ErrQueueFull, p.Enqueue("batch", record("batch")))
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, p.Enqueue("interactive", record("interactive")))
+	}
+	close(block)
+	wg.Wait()
+
+	// 權重高的隊列不需要等待堆積的 batch 任務
+	last := 0
+	for i, name := range order {
+		if name == "interactive" {
+			last = i
+		}
+	}
+	assert.True(t, last < 8, order)
+	assert.Equal(t, 0, p.QueueLen("batch"))
+
+	assert.Equal(t, ErrUnknownQueue, p.Enqueue("tenant-a", func() {}))
+	p.Release()
+	assert.Equal(t, ErrPoolClosed, p.Enqueue("batch", func() {}))
+
+	// Reboot 之後可以繼續排隊
+	p.Reboot()
+	done := make(chan struct{})
+	assert.Nil(t, p.Enqueue("interactive", func() { close(done) }))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("queued task is not executed after reboot")
+	}
+
+	plain, _ := NewPool(1)
+	defer plain.Release()
+	assert.Equal(t, ErrQueueNotEnabled, plain.Enqueue("batch", func() {}))
+}
+
+func TestFairQueueSaturated(t *testing.T) {
+	for name, option := range map[string]Option{
+		"non blocking":       WithNonblocking(true),
+		"max blocking tasks": WithMaxBlockingTasks(1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, _ := NewPool(2, option, WithQueues(map[string]QueueConfig{DefaultQueue: {}}))
+			defer p.Release()
+
+			// 池子滿了之後，已經接受的排隊任務仍然要等到 worker 執行，不能被丟棄
+			block := make(chan struct{})
+			for i := 0; i < 2; i++ {
+				assert.Nil(t, p.Submit(func() { <-block }))
+			}
+			var wg sync.WaitGroup
+			var executed int32
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				assert.Nil(t, p.Enqueue("tenant", func() {
+					atomic.AddInt32(&executed, 1)
+					wg.Done()
+				}))
+			}
+			time.Sleep(10 * time.Millisecond)
+			close(block)
+			wg.Wait()
+			assert.Equal(t, int32(50), atomic.LoadInt32(&executed))
+			assert.Equal(t, 0, p.QueueLen("tenant"))
+		})
+	}
+}
+
+func TestFairQueueDefault(t *testing.T) {
+	q := newFairQueue(map[string]QueueConfig{DefaultQueue: {Weight: 1, MaxLength: 1}})
+	assert.Nil(t, q.push("tenant-a", func() {}))
+	assert.Equal(t, ErrQueueFull, q.push("tenant-a", func() {}))
+	assert.Nil(t, q.push("tenant-b", func() {}))
+	assert.Equal(t, ErrQueueFull, q.push("tenant-b", func() {}))
+	assert.Equal(t, 1, q.len("tenant-a"))
+
+	// 每個租戶輪流取出
+	_, ok := q.pop(0)
+	assert.True(t, ok)
+	_, ok = q.pop(0)
+	assert.True(t, ok)
+	assert.Equal(t, 0, q.len("tenant-a"))
+	assert.Equal(t, 0, q.len("tenant-b"))
+	assert.Equal(t, 0, len(q.queues))
+
+	assert.Equal(t, 0, q.close())
+	_, ok = q.pop(0)
+	assert.False(t, ok)
+}
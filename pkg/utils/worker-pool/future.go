@@ -0,0 +1,228 @@
+package worker_pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// FutureTask 有返回值的任務，ctx 會在 Future 被取消時結束
+type FutureTask func(ctx context.Context) (interface{}, error)
+
+// PanicError 任務發生 panic 時，Future 返回的錯誤
+type PanicError struct {
+	// Value recover 取得的值
+	Value interface{}
+	// Stack 發生 panic 時的堆疊
+	Stack []byte
+}
+
+// Error ...
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panic: %v", e.Value)
+}
+
+// Future 非同步任務的結果，任務完成、發生錯誤或被取消之後 Done 會被關閉
+type Future struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+	value  interface{}
+	err    error
+}
+
+func newFuture(ctx context.Context) *Future {
+	f := &Future{done: make(chan struct{})}
+	f.ctx, f.cancel = context.WithCancel(ctx)
+	return f
+}
+
+// Done 任務結束時關閉
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Get 等待任務結束並返回結果，ctx 先結束時返回 ctx.Err()，不會取消任務
+func (f *Future) Get(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Cancel 取消任務，還沒開始的任務不會執行，執行中的任務會收到 ctx 結束的通知，
+// 任務已經結束時返回 false
+func (f *Future) Cancel() bool {
+	return f.complete(nil, ErrFutureCanceled)
+}
+
+// complete 只有第一次呼叫會生效
+func (f *Future) complete(value interface{}, err error) bool {
+	completed := false
+	f.once.Do(func() {
+		f.value, f.err = value, err
+		completed = true
+		close(f.done)
+		f.cancel()
+	})
+	return completed
+}
+
+// run 在 worker 上執行任務，panic 會轉成 PanicError
+func (f *Future) run(task FutureTask) {
+	select {
+	case <-f.done:
+		return
+	default:
+	}
+	if err := f.ctx.Err(); err != nil {
+		f.complete(nil, err)
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			f.complete(nil, &PanicError{Value: p, Stack: debug.Stack()})
+		}
+	}()
+	f.complete(task(f.ctx))
+}
+
+// SubmitFuture 提交有返回值的任務，池子關閉或已滿時返回 Submit 的錯誤
+func (p *Pool) SubmitFuture(task FutureTask) (*Future, error) {
+	return p.submitFuture(context.Background(), task)
+}
+
+// submitFuture 以 SubmitContext 提交，等待 worker 時 ctx 結束就返回 ctx.Err()
+func (p *Pool) submitFuture(ctx context.Context, task FutureTask) (*Future, error) {
+	f := newFuture(ctx)
+	if err := p.SubmitContext(ctx, func(context.Context) { f.run(task) }); err != nil {
+		f.cancel()
+		return nil, err
+	}
+	return f, nil
+}
+
+// WaitAll 等待所有任務完成並依序返回結果，任一任務失敗時立刻返回該錯誤
+func WaitAll(ctx context.Context, futures ...*Future) ([]interface{}, error) {
+	stop := make(chan struct{})
+	defer close(stop)
+	failed := make(chan error, 1)
+	for _, f := range futures {
+		go func(f *Future) {
+			select {
+			case <-f.done:
+				if f.err != nil {
+					select {
+					case failed <- f.err:
+					default:
+					}
+				}
+			case <-stop:
+			}
+		}(f)
+	}
+
+	values := make([]interface{}, len(futures))
+	for i, f := range futures {
+		select {
+		case <-f.done:
+			if f.err != nil {
+				return values, f.err
+			}
+			values[i] = f.value
+		case err := <-failed:
+			return values, err
+		case <-ctx.Done():
+			return values, ctx.Err()
+		}
+	}
+	return values, nil
+}
+
+// WaitAny 等待第一個結束的任務，返回它的索引與結果，沒有任務時返回 -1
+func WaitAny(ctx context.Context, futures ...*Future) (int, interface{}, error) {
+	if len(futures) == 0 {
+		return -1, nil, nil
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	first := make(chan int, len(futures))
+	for i, f := range futures {
+		go func(i int, f *Future) {
+			select {
+			case <-f.done:
+				first <- i
+			case <-stop:
+			}
+		}(i, f)
+	}
+	select {
+	case i := <-first:
+		return i, futures[i].value, futures[i].err
+	case <-ctx.Done():
+		return -1, nil, ctx.Err()
+	}
+}
+
+// Map 以最多 limit 個並行任務對 items 執行 fn，結果與 items 的順序相同，
+// 任一任務失敗時取消其餘的任務並返回該錯誤，limit <= 0 時使用池子的容量
+func Map(ctx context.Context, p *Pool, items []interface{}, limit int, fn func(ctx context.Context, item interface{}) (interface{}, error)) ([]interface{}, error) {
+	if limit <= 0 {
+		limit = p.Cap()
+	}
+	if limit <= 0 || limit > len(items) {
+		limit = len(items)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sema := make(chan struct{}, limit)
+	futures := make([]*Future, 0, len(items))
+	var err error
+	for _, item := range items {
+		select {
+		case sema <- struct{}{}:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+		item := item
+		f, submitErr := p.submitFuture(ctx, func(ctx context.Context) (interface{}, error) {
+			defer func() { <-sema }()
+			value, err := fn(ctx, item)
+			if err != nil {
+				cancel()
+			}
+			return value, err
+		})
+		if submitErr != nil {
+			err = submitErr
+			break
+		}
+		futures = append(futures, f)
+	}
+	if err == nil {
+		var values []interface{}
+		if values, err = WaitAll(ctx, futures...); err == nil {
+			return values, nil
+		}
+	}
+	cancel()
+	// 等待所有任務結束，優先返回任務本身的錯誤，而不是取消造成的錯誤
+	for _, f := range futures {
+		<-f.done
+	}
+	for _, f := range futures {
+		if f.err != nil && !errors.Is(f.err, context.Canceled) && !errors.Is(f.err, ErrFutureCanceled) {
+			return nil, f.err
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,148 @@
+package worker_pool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuture(t *testing.T) {
+	p, _ := NewPool(4)
+	defer p.Release()
+
+	f, err := p.SubmitFuture(func(ctx context.Context) (interface{}, error) {
+		return 42, nil
+	})
+	assert.Nil(t, err)
+	value, err := f.Get(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 42, value)
+	assert.False(t, f.Cancel())
+
+	// panic 轉成 PanicError
+	f, _ = p.SubmitFuture(func(ctx context.Context) (interface{}, error) {
+		panic("boom")
+	})
+	_, err = f.Get(context.Background())
+	var panicErr *PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.NotEmpty(t, panicErr.Stack)
+
+	// 取消執行中的任務
+	started := make(chan struct{})
+	f, _ = p.SubmitFuture(func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	_, err = f.Get(ctx)
+	cancel()
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, f.Cancel())
+	<-f.Done()
+	_, err = f.Get(context.Background())
+	assert.Equal(t, ErrFutureCanceled, err)
+
+	p.Release()
+	_, err = p.SubmitFuture(func(ctx context.Context) (interface{}, error) { return nil, nil })
+	assert.Equal(t, ErrPoolClosed, err)
+}
+
+func TestWaitAllAndAny(t *testing.T) {
+	p, _ := NewPool(4)
+	defer p.Release()
+
+	sleep := func(d time.Duration, value interface{}, err error) FutureTask {
+		return func(ctx context.Context) (interface{}, error) {
+			select {
+			case <-time.After(d):
+				return value, err
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+	f1, _ := p.SubmitFuture(sleep(30*time.Millisecond, 1, nil))
+	f2, _ := p.SubmitFuture(sleep(10*time.Millisecond, 2, nil))
+	values, err := WaitAll(context.Background(), f1, f2)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{1, 2}, values)
+
+	// 後面的任務先失敗時不用等待前面的任務
+	failure := errors.New("failure")
+	slow, _ := p.SubmitFuture(sleep(time.Hour, 1, nil))
+	fail, _ := p.SubmitFuture(sleep(10*time.Millisecond, nil, failure))
+	_, err = WaitAll(context.Background(), slow, fail)
+	assert.Equal(t, failure, err)
+
+	fast, _ := p.SubmitFuture(sleep(10*time.Millisecond, "fast", nil))
+	index, value, err := WaitAny(context.Background(), slow, fast)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, index)
+	assert.Equal(t, "fast", value)
+	slow.Cancel()
+
+	index, _, _ = WaitAny(context.Background())
+	assert.Equal(t, -1, index)
+}
+
+func TestMap(t *testing.T) {
+	p, _ := NewPool(10)
+	defer p.Release()
+
+	items := make([]interface{}, 20)
+	for i := range items {
+		items[i] = i
+	}
+	var running, maxRunning int32
+	values, err := Map(context.Background(), p, items, 3, func(ctx context.Context, item interface{}) (interface{}, error) {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return item.(int) * 2, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 20, len(values))
+	assert.Equal(t, 38, values[19])
+	assert.True(t, atomic.LoadInt32(&maxRunning) <= 3)
+
+	// 任一任務失敗時其餘的任務被取消
+	failure := errors.New("failure")
+	var called int32
+	_, err = Map(context.Background(), p, items, 2, func(ctx context.Context, item interface{}) (interface{}, error) {
+		atomic.AddInt32(&called, 1)
+		if item.(int) == 1 {
+			return nil, failure
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	assert.Equal(t, failure, err)
+	assert.True(t, atomic.LoadInt32(&called) < 20)
+
+	// 池子已滿時，ctx 結束會中斷等待 worker 的提交
+	full, _ := NewPool(1)
+	defer full.Release()
+	block := make(chan struct{})
+	defer close(block)
+	assert.Nil(t, full.Submit(func() { <-block }))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = Map(ctx, full, items, 2, func(ctx context.Context, item interface{}) (interface{}, error) {
+		return item, nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
@@ -1,6 +1,10 @@
 package worker_pool
 
-import "time"
+import (
+	"time"
+
+	"github.com/digital-monster-1997/digicore/pkg/dlog"
+)
 
 type Option func(opts *Options)
 
@@ -26,6 +30,14 @@ type Options struct {
 	NonBlocking bool
 	// PanicHandler 如果有壞掉的預設主理方式
 	PanicHandler func(interface{})
+	// PanicRecordHandler 取得包含任務名稱、堆疊與提交時間的 PanicRecord，設定時取代 PanicHandler
+	PanicRecordHandler func(record *PanicRecord)
+	// Logger 沒有設定 panic handler 時記錄 panic 的 logger，預設為 dlog.DigitCore
+	Logger *dlog.Logger
+	// Queues 啟用排隊模式，以 Enqueue 提交的任務依照權重公平分配 worker，
+	// key 為 DefaultQueue 的設定用於其他沒有列出的 key（例如每個租戶一個隊列），
+	// Enqueue 接受的任務在隊列中等待 worker，不受 NonBlocking 與 MaxBlockingTasks 影響
+	Queues map[string]QueueConfig
 }
 
 func WithOptions(options Options) Option{
@@ -68,4 +80,24 @@ func WithPanicHandler(panicHandler func(interface{})) Option {
 	return func(opts *Options) {
 		opts.PanicHandler = panicHandler
 	}
-}
\ No newline at end of file
+}
+// WithQueues ...
+func WithQueues(queues map[string]QueueConfig) Option {
+	return func(opts *Options) {
+		opts.Queues = queues
+	}
+}
+
+// WithPanicRecordHandler ...
+func WithPanicRecordHandler(handler func(record *PanicRecord)) Option {
+	return func(opts *Options) {
+		opts.PanicRecordHandler = handler
+	}
+}
+
+// WithLogger ...
+func WithLogger(logger *dlog.Logger) Option {
+	return func(opts *Options) {
+		opts.Logger = logger
+	}
+}
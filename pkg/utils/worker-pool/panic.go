@@ -0,0 +1,92 @@
+package worker_pool
+
+import (
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/digital-monster-1997/digicore/pkg/dlog"
+)
+
+// PanicRecord 任務發生 panic 時交給 PanicRecordHandler 的資訊
+type PanicRecord struct {
+	// Value recover 取得的值
+	Value interface{}
+	// Stack 發生 panic 時的堆疊
+	Stack []byte
+	// Task 任務的名稱，沒有以 WithTaskName 指定時為函數名稱
+	Task string
+	// SubmitTime 任務提交的時間
+	SubmitTime time.Time
+	// StartTime 任務開始執行的時間
+	StartTime time.Time
+}
+
+// taskInfo 提交任務時記錄的資訊
+type taskInfo struct {
+	// name 以 WithTaskName 指定的名稱
+	name string
+	// fn 使用者提交的函數，沒有名稱時用來取得函數名稱
+	fn interface{}
+	// submitted 提交的時間，用來統計等待的時間
+	submitted time.Time
+	// recovered 任務自行 recover 的 panic（SubmitFunc），設為 true 時 wrap 計入 Panicked
+	recovered *bool
+}
+
+func newTaskInfo(fn interface{}) taskInfo {
+	return taskInfo{fn: fn, submitted: time.Now()}
+}
+
+// taskName 只有在發生 panic 時才解析函數名稱
+func (info taskInfo) taskName() string {
+	if info.name != "" {
+		return info.name
+	}
+	return funcName(info.fn)
+}
+
+func funcName(fn interface{}) string {
+	if fn == nil {
+		return ""
+	}
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		return ""
+	}
+	if f := runtime.FuncForPC(value.Pointer()); f != nil {
+		return f.Name()
+	}
+	return ""
+}
+
+// handlePanic 依序交給 PanicRecordHandler、PanicHandler，都沒有設定時以 dlog 記錄
+func handlePanic(options *Options, value interface{}, fn interface{}) {
+	record, ok := value.(*PanicRecord)
+	if !ok {
+		record = &PanicRecord{Value: value, Stack: debug.Stack(), Task: funcName(fn)}
+	}
+	if options.PanicRecordHandler != nil {
+		options.PanicRecordHandler(record)
+		return
+	}
+	if options.PanicHandler != nil {
+		options.PanicHandler(record.Value)
+		return
+	}
+	logger := options.Logger
+	if logger == nil {
+		logger = dlog.DigitCore
+	}
+	fields := []dlog.Field{
+		dlog.FieldMod("worker_pool"),
+		dlog.String("task", record.Task),
+		dlog.Any("panic", record.Value),
+		dlog.FieldStack(record.Stack),
+	}
+	if !record.SubmitTime.IsZero() {
+		fields = append(fields, dlog.Duration("wait", record.StartTime.Sub(record.SubmitTime)))
+	}
+	logger.Error("worker exits from a panic", fields...)
+}
@@ -0,0 +1,52 @@
+package worker_pool
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digital-monster-1997/digicore/pkg/dlog"
+	"github.com/digital-monster-1997/digicore/pkg/dlog/dlogtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func panickingTask() {
+	panic("boom")
+}
+
+func TestPanicRecord(t *testing.T) {
+	records := make(chan *PanicRecord, 1)
+	p, _ := NewPool(1, WithPanicRecordHandler(func(record *PanicRecord) { records <- record }))
+	defer p.Release()
+
+	before := time.Now()
+	assert.Nil(t, p.Submit(panickingTask))
+	record := <-records
+	assert.Equal(t, "boom", record.Value)
+	assert.True(t, strings.HasSuffix(record.Task, ".panickingTask"))
+	assert.Contains(t, string(record.Stack), "panickingTask")
+	assert.False(t, record.SubmitTime.Before(before))
+	assert.False(t, record.StartTime.Before(record.SubmitTime))
+
+	// PoolWithFunc 的任務名稱為 poolFunc
+	pf, _ := NewPoolWithFunc(1, func(interface{}) { panickingTask() },
+		WithPanicRecordHandler(func(record *PanicRecord) { records <- record }))
+	defer pf.Release()
+	assert.Nil(t, pf.Invoke(nil))
+	record = <-records
+	assert.Equal(t, "boom", record.Value)
+	assert.Contains(t, record.Task, "TestPanicRecord")
+}
+
+func TestPanicLogged(t *testing.T) {
+	logger, logs := dlogtest.New()
+	p, _ := NewPool(1, WithLogger(logger))
+	defer p.Release()
+
+	assert.Nil(t, p.Submit(panickingTask))
+	for logs.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	logs.FilterMod("worker_pool").AssertLogged(t, dlog.ErrorLevel, "worker exits from a panic", dlog.Any("panic", "boom"))
+	assert.Equal(t, 1, logs.FilterFieldKey("task").FilterFieldKey("stack").FilterFieldKey("wait").Len())
+}
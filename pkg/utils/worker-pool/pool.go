@@ -1,108 +1,122 @@
 package worker_pool
 
 import (
+	"context"
 	"errors"
-	"github.com/digital-monster-1997/digicore/pkg/utils/spin_lock"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
 type Pool struct{
-	// capacity 池子大小
-	capacity int32
-	// running 正在執行中的 worker 數量
-	running int32
-	// lock 鎖的介面，可以自己實現，也可以交由別人實現
-	lock sync.Locker
-	// goroutine 的 workers
-	workers workerQueue
-	// status 用於通知池子關閉
-	status int32
-	// cond 用來取得一個空閑的 goroutine
-	cond *sync.Cond
-	// workerCache 放入 Sync Pool 當中當作快取
-	workerCache sync.Pool
-	// blockingNum 在 pool.submit 阻塞的上限值，受到 pool.lock 保護
-	blockingNum int
-
-	stopHeartBeat chan struct{}
-	options Options
+	poolCore
+
+	// taskLock 保護 taskCancels
+	taskLock sync.Mutex
+	// taskCancels 以 SubmitContext 提交且還在執行的任務，Release 時會取消它們的 context
+	taskCancels map[uint64]context.CancelFunc
+	// taskSeq taskCancels 的流水號
+	taskSeq uint64
+	// queue 排隊模式的隊列，沒有設定 Queues 時為 nil
+	queue *fairQueue
+	// stats 任務的統計
+	stats poolStats
+	// inflight 已經接受但還沒結束的任務，包含排隊中以及阻塞等待 worker 的任務
+	inflight int64
+	// drained Shutdown 時 inflight 歸零的通知
+	drained chan struct{}
 }
 
 // ---------------------------------------------- 公有函數區 ----------------------------------------------
 
-// IsClosed 判斷池子是否已關閉
-func (p *Pool)IsClosed()bool{
-	return atomic.LoadInt32(&p.status) == CLOSED
-}
-
-// Running 看看目前有多少正在運作的 goroutine
-func (p *Pool) Running() int {
-	return int(atomic.LoadInt32(&p.running))
+// IsDraining 判斷池子是否正在 Shutdown，這時不接受新的任務，但已經接受的任務會繼續執行
+func (p *Pool) IsDraining() bool {
+	return atomic.LoadInt32(&p.status) == DRAINING
 }
 
-// Cap 返回目前池子的容量大小
-func (p *Pool) Cap() int {
-	return int(atomic.LoadInt32(&p.capacity))
-}
-
-// Free 取得目前閒置的 goroutine 數量
-func(p *Pool)Free() int{
-	c := p.Cap()
-	if c<0{
-		return -1
+// Submit 提交任務
+func (p *Pool)Submit(task func())error{
+	if !p.accepting() {
+		return ErrPoolClosed
 	}
-	return c - p.Running()
+	return p.submit(context.Background(), newTaskInfo(task), task)
 }
 
-// Submit 提交任務
-func (p *Pool)Submit(task func())error{
-	if p.IsClosed(){
-		// 池子已關閉，不接受提交
+// SubmitContext 提交需要 context 的任務，等待 worker 時 ctx 結束就返回 ctx.Err()，
+// 任務收到的 ctx 會在呼叫方的 ctx 結束或池子 Release 時結束，任務應該自行檢查並盡早返回
+func (p *Pool) SubmitContext(ctx context.Context, task func(ctx context.Context)) error {
+	if !p.accepting() {
 		return ErrPoolClosed
 	}
-	var w *Worker
-	// 取出 worker
-	if w = p.retrieveWorker(); w==nil{
-		return ErrPoolOverload
+	if err := ctx.Err(); err != nil {
+		atomic.AddUint64(&p.stats.rejected, 1)
+		return err
 	}
-	w.task <- task
-	return nil
+	taskCtx, cancel := context.WithCancel(ctx)
+	id := p.trackTask(cancel)
+	err := p.submit(ctx, newTaskInfo(task), func() {
+		defer p.untrackTask(id, cancel)
+		task(taskCtx)
+	})
+	if err != nil {
+		p.untrackTask(id, cancel)
+	}
+	return err
 }
 
-// ChangeSize 調整池子大小，對於 pre alloc 的池子無效
-func(p *Pool)ChangeSize(size int){
-	// 取得池子大小
-	cap := p.Cap()
-	// 如果池子的大小為 -1 或者要調整的數量是負數，或者調整的數量跟池子大小一樣，不用改變
-	// 預先建立的池子大小也不可改變
-	if cap == -1 || size <=0 || size == cap || p.options.PreAlloc{
-		return
+// ShutdownReport Shutdown 逾時時被放棄的任務
+type ShutdownReport struct {
+	// Running 還在執行中的任務，它們的 SubmitContext ctx 會被取消
+	Running int
+	// Blocked 還在等待 worker 的提交，它們會返回 ErrPoolClosed
+	Blocked int
+	// Queued 排隊模式中被丟棄的任務
+	Queued int
+}
+
+// Abandoned 被放棄的任務總數
+func (r ShutdownReport) Abandoned() int {
+	return r.Running + r.Blocked + r.Queued
+}
+
+// Shutdown 停止接受新的任務，等待執行中、排隊中以及阻塞等待 worker 的任務結束之後關閉池子，
+// ctx 先結束時直接關閉池子並返回 ctx.Err()，report 記錄被放棄的任務
+func (p *Pool) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	if !atomic.CompareAndSwapInt32(&p.status, OPENED, DRAINING) {
+		return ShutdownReport{}, ErrPoolClosed
+	}
+	// 清掉之前留下的通知
+	select {
+	case <-p.drained:
+	default:
 	}
-	atomic.StoreInt32(&p.capacity, int32(size))
-	// 如果條小，正在執行的執行完成後，沒有人在使用它，時間到了會自行淘汰
-	// 如果條大，要通知正在阻塞的，有新的 worker 可以用了，隨機挑選一個來使用
-	if size > cap {
-		if size-cap == 1{
-			p.cond.Signal()
-			return
+	var (
+		report ShutdownReport
+		err    error
+	)
+	for err == nil && atomic.LoadInt64(&p.inflight) > 0 {
+		select {
+		case <-p.drained:
+		case <-ctx.Done():
+			err = ctx.Err()
+			report = p.abandoned()
 		}
-		p.cond.Broadcast()
 	}
+	p.Release()
+	return report, err
 }
 
 // Release 關閉這個池子，並釋放工作隊列
 func(p *Pool)Release(){
 	// 如果交換失敗了，就直接回，可能已經關閉了，不用再關一次
-	if !atomic.CompareAndSwapInt32(&p.status, OPENED,CLOSED){
+	if !atomic.CompareAndSwapInt32(&p.status, OPENED,CLOSED) && !atomic.CompareAndSwapInt32(&p.status, DRAINING, CLOSED){
 		return
 	}
-	// 有一些人可能在 retrieveWorker() 等待喚醒，以防止那些呼叫的人無限阻塞
-	p.lock.Lock()
-	p.workers.reset()
-	p.lock.Unlock()
-	p.cond.Broadcast()
+	p.closeWorkers()
+	p.cancelTasks()
+	if p.queue != nil {
+		p.addInflight(-int64(p.queue.close()))
+	}
 }
 
 // ReleaseTimeout is like Release but with a timeout, it waits all workers to exit before timing out.
@@ -110,142 +124,145 @@ func (p *Pool) ReleaseTimeout(timeout time.Duration) error {
 	if p.IsClosed() {
 		return errors.New("pool is already closed")
 	}
-	select {
-	case p.stopHeartBeat <- struct{}{}:
-		<-p.stopHeartBeat
-	default:
-	}
 	p.Release()
-	endTime := time.Now().Add(timeout)
-	for time.Now().Before(endTime) {
-		if p.Running() == 0 {
-			return nil
-		}
-		time.Sleep(10 * time.Millisecond)
-	}
-	return ErrTimeout
+	return p.waitWorkers(timeout)
 }
 
-// Reboot reboots a closed pool.
+// Reboot 重新開啟已經關閉的池子，Shutdown 還沒結束時無效
 func (p *Pool) Reboot() {
 	if atomic.CompareAndSwapInt32(&p.status, CLOSED, OPENED) {
-		go p.purgePeriodically()
+		p.startHeartBeat()
+		if p.queue != nil {
+			go p.dispatch(p.queue, p.queue.reopen())
+		}
 	}
 }
 
 // ---------------------------------------------- 私有函數區 ----------------------------------------------
 
-// purgePeriodically 定期清除過期的 worker
-func(p *Pool)purgePeriodically(){
-	heartBeat := time.NewTicker(p.options.ExpiryDuration)
-	defer heartBeat.Stop()
-	for{
-		select{
-		case <-heartBeat.C:
-		case <-p.stopHeartBeat:
-			p.stopHeartBeat <- struct{}{}
-			return
-		}
-		// 關閉了就不用清了，直接停止
-		if p.IsClosed(){
-			break
-		}
-		// 把過期與沒過期切分開ㄌㄞ˙
-		p.lock.Lock()
-		expiredWorkers := p.workers.retrieveExpiry(p.options.ExpiryDuration)
-		p.lock.Unlock()
-		// 逐個清理過期的
-		for i := range expiredWorkers{
-			expiredWorkers[i].task <- nil
-			expiredWorkers[i] = nil
-		}
-		if p.Running() ==0 {
-			p.cond.Broadcast()
-		}
+// accepting 只有開啟的池子接受新的任務
+func (p *Pool) accepting() bool {
+	if atomic.LoadInt32(&p.status) != OPENED {
+		atomic.AddUint64(&p.stats.rejected, 1)
+		return false
 	}
-
-
+	return true
 }
-// revertWorker 放回一個 worker to pool
-func (p *Pool) revertWorker(w *Worker) bool{
-	if capacity := p.Cap();(capacity>0 && p.Running() > capacity) || p.IsClosed(){
-		p.cond.Broadcast()
-		return false
+
+// addInflight 調整 inflight，Shutdown 時歸零會通知 drained
+func (p *Pool) addInflight(delta int64) {
+	if atomic.AddInt64(&p.inflight, delta) == 0 && p.IsDraining() {
+		select {
+		case p.drained <- struct{}{}:
+		default:
+		}
 	}
-	w.recycleTime = time.Now()
+}
+
+// abandoned Shutdown 逾時時還沒結束的任務
+func (p *Pool) abandoned() ShutdownReport {
 	p.lock.Lock()
-	if p.IsClosed(){
-		p.lock.Unlock()
-		return false
+	report := ShutdownReport{Blocked: p.blockingNum}
+	p.lock.Unlock()
+	if p.queue != nil {
+		report.Queued = p.queue.size()
 	}
-	err := p.workers.insert(w)
-	if err != nil {
-		p.lock.Unlock()
-		return false
+	report.Running = int(atomic.LoadInt64(&p.inflight)) - report.Blocked - report.Queued
+	if report.Running < 0 {
+		report.Running = 0
 	}
-	p.cond.Signal()
-	p.lock.Unlock()
-	return true
+	return report
 }
 
-// retrieveWorker returns an available worker to run the tasks.
-func (p *Pool) retrieveWorker() (w *Worker) {
-	spawnWorker := func() {
-		w = p.workerCache.Get().(*Worker)
-		w.run()
+// submit 計入 inflight 之後交給 handoff
+func (p *Pool) submit(ctx context.Context, info taskInfo, task func()) error {
+	p.addInflight(1)
+	if err := p.handoff(ctx, info, task); err != nil {
+		p.addInflight(-1)
+		return err
 	}
+	return nil
+}
 
-	p.lock.Lock()
+// handoff 取得 worker 並交付任務，呼叫方已經計入 inflight，info 用來統計等待的時間以及記錄 panic
+func (p *Pool) handoff(ctx context.Context, info taskInfo, task func()) error {
+	return p.deliver(ctx, info, task, false)
+}
 
-	w = p.workers.detach()
-	if w != nil { // first try to fetch the worker from the queue
-		p.lock.Unlock()
-	} else if capacity := p.Cap(); capacity == -1 || capacity > p.Running() {
-		// if the worker queue is empty and we don't run out of the pool capacity,
-		// then just spawn a new worker goroutine.
-		p.lock.Unlock()
-		spawnWorker()
-	} else { // otherwise, we'll have to keep them blocked and wait for at least one worker to be put back into pool.
-		if p.options.NonBlocking {
-			p.lock.Unlock()
-			return
-		}
-	retry:
-		if p.options.MaxBlockingTasks != 0 && p.blockingNum >= p.options.MaxBlockingTasks {
-			p.lock.Unlock()
-			return
-		}
-		p.blockingNum++
-		p.cond.Wait() // block and wait for an available worker
-		p.blockingNum--
-		var nw int
-		if nw = p.Running(); nw == 0 { // awakened by the scavenger
-			p.lock.Unlock()
-			if !p.IsClosed() {
-				spawnWorker()
-			}
-			return
+// deliver handoff 的實作，wait 為 true 時忽略 NonBlocking 與 MaxBlockingTasks，
+// 一直等到有空閒的 worker、ctx 結束或池子關閉，給已經接受的排隊任務使用
+func (p *Pool) deliver(ctx context.Context, info taskInfo, task func(), wait bool) error {
+	if p.IsClosed() {
+		// 池子已關閉，不接受提交
+		atomic.AddUint64(&p.stats.rejected, 1)
+		return ErrPoolClosed
+	}
+	var w *Worker
+	// 取出 worker
+	if w = p.retrieveWorker(ctx, wait); w == nil {
+		atomic.AddUint64(&p.stats.rejected, 1)
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		if w = p.workers.detach(); w == nil {
-			if nw < capacity {
-				p.lock.Unlock()
-				spawnWorker()
-				return
-			}
-			goto retry
+		if p.IsClosed() {
+			return ErrPoolClosed
 		}
+		return ErrPoolOverload
+	}
+	atomic.AddUint64(&p.stats.submitted, 1)
+	w.task <- p.wrap(task, info)
+	return nil
+}
 
-		p.lock.Unlock()
+// trackTask 記錄執行中任務的 cancel，池子已經關閉時直接取消
+func (p *Pool) trackTask(cancel context.CancelFunc) uint64 {
+	p.taskLock.Lock()
+	defer p.taskLock.Unlock()
+	if p.IsClosed() {
+		cancel()
+		return 0
+	}
+	if p.taskCancels == nil {
+		p.taskCancels = make(map[uint64]context.CancelFunc)
 	}
-	return
+	p.taskSeq++
+	p.taskCancels[p.taskSeq] = cancel
+	return p.taskSeq
 }
 
-func (p *Pool)incRunning(){
-	atomic.AddInt32(&p.running,1)
+// untrackTask 任務結束時移除記錄並釋放 context
+func (p *Pool) untrackTask(id uint64, cancel context.CancelFunc) {
+	cancel()
+	p.taskLock.Lock()
+	delete(p.taskCancels, id)
+	p.taskLock.Unlock()
 }
 
-func (p *Pool)decRunning(){
-	atomic.AddInt32(&p.running,-1)
+// cancelTasks 取消所有執行中的任務的 context
+func (p *Pool) cancelTasks() {
+	p.taskLock.Lock()
+	cancels := p.taskCancels
+	p.taskCancels = nil
+	p.taskLock.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
+
+// retrieveWorker 取得一個可以用的 worker，阻塞等待時如果 ctx 結束會返回 nil
+func (p *Pool) retrieveWorker(ctx context.Context, wait bool) *Worker {
+	w := p.poolCore.retrieveWorker(ctx, wait, p.spawnWorker)
+	if w == nil {
+		return nil
+	}
+	return w.(*Worker)
+}
+
+// spawnWorker 從快取取出並啟動新的 worker
+func (p *Pool) spawnWorker() worker {
+	w := p.workerCache.Get().(*Worker)
+	w.run()
+	return w
 }
 
 // ---------------------------------------------- 新建一個 pool ----------------------------------------------
@@ -253,24 +270,11 @@ func (p *Pool)decRunning(){
 
 // NewPool ...
 func NewPool(size int, options ...Option) (*Pool, error) {
-	opts := loadOptions(options...)
-
-	if size <= 0 {
-		size = -1
-	}
-
-	if expiry := opts.ExpiryDuration; expiry < 0 {
-		return nil, ErrInvalidPoolExpiry
-	} else if expiry == 0 {
-		opts.ExpiryDuration = DefaultCleanIntervalTime
-	}
-
-
 	p := &Pool{
-		capacity:      int32(size),
-		lock:         	spin_lock.NewSpinLock(),
-		stopHeartBeat: make(chan struct{}, 1),
-		options:       *opts,
+		drained: make(chan struct{}, 1),
+	}
+	if err := p.init(size, options); err != nil {
+		return nil, err
 	}
 	p.workerCache.New = func() interface{} {
 		return &Worker{
@@ -278,19 +282,14 @@ func NewPool(size int, options ...Option) (*Pool, error) {
 			task: make(chan func(), workerChanCap),
 		}
 	}
-	if p.options.PreAlloc {
-		if size == -1 {
-			return nil, ErrInvalidPreAllocSize
-		}
-		p.workers = newWorkerQueue(loopQueueType, size)
-	} else {
-		p.workers = newWorkerQueue(stackType, 0)
-	}
-
-	p.cond = sync.NewCond(p.lock)
 
 	// Start a goroutine to clean up expired workers periodically.
-	go p.purgePeriodically()
+	p.startHeartBeat()
+
+	if len(p.options.Queues) > 0 {
+		p.queue = newFairQueue(p.options.Queues)
+		go p.dispatch(p.queue, 0)
+	}
 
 	return p, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,274 @@
+package worker_pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/digital-monster-1997/digicore/pkg/utils/spin_lock"
+)
+
+// poolCore Pool 與 PoolWithFunc 共用的 worker 生命週期：容量、取得與放回 worker、
+// 定期清除過期的 worker 以及關閉與重新開啟
+type poolCore struct {
+	// capacity 池子大小
+	capacity int32
+	// running 正在執行中的 worker 數量
+	running int32
+	// lock 鎖的介面，可以自己實現，也可以交由別人實現
+	lock sync.Locker
+	// goroutine 的 workers
+	workers workerQueue
+	// status 用於通知池子關閉
+	status int32
+	// cond 用來取得一個空閑的 goroutine
+	cond *sync.Cond
+	// workerCache 放入 Sync Pool 當中當作快取，New 由各自的池子設定
+	workerCache sync.Pool
+	// blockingNum 阻塞等待 worker 的數量，受到 lock 保護
+	blockingNum int
+
+	// stopHeartBeat 關閉時停止 purgePeriodically，heartBeatDone 在它結束時關閉
+	stopHeartBeat chan struct{}
+	heartBeatDone chan struct{}
+	options       Options
+}
+
+// init 載入選項並建立 worker 隊列，呼叫方設定 workerCache.New 之後再 startHeartBeat
+func (p *poolCore) init(size int, options []Option) error {
+	opts := loadOptions(options...)
+
+	if size <= 0 {
+		size = -1
+	}
+
+	if expiry := opts.ExpiryDuration; expiry < 0 {
+		return ErrInvalidPoolExpiry
+	} else if expiry == 0 {
+		opts.ExpiryDuration = DefaultCleanIntervalTime
+	}
+
+	p.capacity = int32(size)
+	p.lock = spin_lock.NewSpinLock()
+	p.options = *opts
+	if p.options.PreAlloc {
+		if size == -1 {
+			return ErrInvalidPreAllocSize
+		}
+		p.workers = newWorkerQueue(loopQueueType, size)
+	} else {
+		p.workers = newWorkerQueue(stackType, 0)
+	}
+	p.cond = sync.NewCond(p.lock)
+	return nil
+}
+
+// IsClosed 判斷池子是否已關閉
+func (p *poolCore) IsClosed() bool {
+	return atomic.LoadInt32(&p.status) == CLOSED
+}
+
+// Running 看看目前有多少正在運作的 goroutine
+func (p *poolCore) Running() int {
+	return int(atomic.LoadInt32(&p.running))
+}
+
+// Cap 返回目前池子的容量大小
+func (p *poolCore) Cap() int {
+	return int(atomic.LoadInt32(&p.capacity))
+}
+
+// Free 取得目前閒置的 goroutine 數量
+func (p *poolCore) Free() int {
+	c := p.Cap()
+	if c < 0 {
+		return -1
+	}
+	return c - p.Running()
+}
+
+// ChangeSize 調整池子大小，對於 pre alloc 的池子無效
+func (p *poolCore) ChangeSize(size int) {
+	// 取得池子大小
+	cap := p.Cap()
+	// 如果池子的大小為 -1 或者要調整的數量是負數，或者調整的數量跟池子大小一樣，不用改變
+	// 預先建立的池子大小也不可改變
+	if cap == -1 || size <= 0 || size == cap || p.options.PreAlloc {
+		return
+	}
+	atomic.StoreInt32(&p.capacity, int32(size))
+	// 如果條小，正在執行的執行完成後，沒有人在使用它，時間到了會自行淘汰
+	// 如果條大，要通知正在阻塞的，有新的 worker 可以用了，隨機挑選一個來使用
+	if size > cap {
+		if size-cap == 1 {
+			p.cond.Signal()
+			return
+		}
+		p.cond.Broadcast()
+	}
+}
+
+// startHeartBeat 啟動 purgePeriodically，每次開啟池子使用新的 channel
+func (p *poolCore) startHeartBeat() {
+	p.stopHeartBeat = make(chan struct{})
+	p.heartBeatDone = make(chan struct{})
+	go p.purgePeriodically(p.stopHeartBeat, p.heartBeatDone)
+}
+
+// purgePeriodically 定期清除過期的 worker
+func (p *poolCore) purgePeriodically(stop, done chan struct{}) {
+	heartBeat := time.NewTicker(p.options.ExpiryDuration)
+	defer heartBeat.Stop()
+	defer close(done)
+	for {
+		select {
+		case <-heartBeat.C:
+		case <-stop:
+			return
+		}
+		// 關閉了就不用清了，直接停止
+		if p.IsClosed() {
+			break
+		}
+		// 把過期與沒過期切分開
+		p.lock.Lock()
+		expiredWorkers := p.workers.retrieveExpiry(p.options.ExpiryDuration)
+		p.lock.Unlock()
+		// 逐個清理過期的
+		for i := range expiredWorkers {
+			expiredWorkers[i].finish()
+			expiredWorkers[i] = nil
+		}
+		if p.Running() == 0 {
+			p.cond.Broadcast()
+		}
+	}
+}
+
+// closeWorkers 呼叫方把狀態改成 CLOSED 之後，停止 purgePeriodically 並釋放閒置的 worker，
+// 喚醒在 retrieveWorker 等待的人，以防止那些呼叫的人無限阻塞
+func (p *poolCore) closeWorkers() {
+	close(p.stopHeartBeat)
+	<-p.heartBeatDone
+	p.lock.Lock()
+	p.workers.reset()
+	p.lock.Unlock()
+	p.cond.Broadcast()
+}
+
+// waitWorkers 等待所有 worker 結束，超過 timeout 時返回 ErrTimeout
+func (p *poolCore) waitWorkers(timeout time.Duration) error {
+	endTime := time.Now().Add(timeout)
+	for time.Now().Before(endTime) {
+		if p.Running() == 0 {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return ErrTimeout
+}
+
+// revertWorker 放回一個 worker to pool，worker 已經更新過 recycleTime
+func (p *poolCore) revertWorker(w worker) bool {
+	if capacity := p.Cap(); (capacity > 0 && p.Running() > capacity) || p.IsClosed() {
+		p.cond.Broadcast()
+		return false
+	}
+	p.lock.Lock()
+	if p.IsClosed() {
+		p.lock.Unlock()
+		return false
+	}
+	err := p.workers.insert(w)
+	if err != nil {
+		p.lock.Unlock()
+		return false
+	}
+	p.cond.Signal()
+	p.lock.Unlock()
+	return true
+}
+
+// retrieveWorker returns an available worker to run the tasks.
+// spawn 從 workerCache 取出並啟動新的 worker，阻塞等待時如果 ctx 結束或池子關閉會返回 nil，
+// wait 為 true 時忽略 NonBlocking 與 MaxBlockingTasks，一定會等待
+func (p *poolCore) retrieveWorker(ctx context.Context, wait bool, spawn func() worker) (w worker) {
+	p.lock.Lock()
+
+	if w = p.workers.detach(); w != nil { // first try to fetch the worker from the queue
+		p.lock.Unlock()
+	} else if capacity := p.Cap(); capacity == -1 || capacity > p.Running() {
+		// if the worker queue is empty and we don't run out of the pool capacity,
+		// then just spawn a new worker goroutine.
+		p.lock.Unlock()
+		w = spawn()
+	} else { // otherwise, we'll have to keep them blocked and wait for at least one worker to be put back into pool.
+		if p.options.NonBlocking && !wait {
+			p.lock.Unlock()
+			return
+		}
+		// cond 無法和 channel 一起 select，ctx 結束時喚醒所有等待的人再各自檢查
+		if done := ctx.Done(); done != nil {
+			stop := make(chan struct{})
+			defer close(stop)
+			go func() {
+				select {
+				case <-done:
+					p.lock.Lock()
+					p.cond.Broadcast()
+					p.lock.Unlock()
+				case <-stop:
+				}
+			}()
+		}
+	retry:
+		if p.IsClosed() {
+			p.lock.Unlock()
+			return
+		}
+		if ctx.Err() != nil {
+			// 可能消耗了別人的喚醒，轉交給下一個等待的人
+			p.cond.Signal()
+			p.lock.Unlock()
+			return
+		}
+		if !wait && p.options.MaxBlockingTasks != 0 && p.blockingNum >= p.options.MaxBlockingTasks {
+			p.lock.Unlock()
+			return
+		}
+		p.blockingNum++
+		p.cond.Wait() // block and wait for an available worker
+		p.blockingNum--
+		if p.IsClosed() {
+			p.lock.Unlock()
+			return
+		}
+		var nw int
+		if nw = p.Running(); nw == 0 { // awakened by the scavenger
+			p.lock.Unlock()
+			if !p.IsClosed() && ctx.Err() == nil {
+				w = spawn()
+			}
+			return
+		}
+		if w = p.workers.detach(); w == nil {
+			if nw < capacity {
+				p.lock.Unlock()
+				w = spawn()
+				return
+			}
+			goto retry
+		}
+		p.lock.Unlock()
+	}
+	return
+}
+
+func (p *poolCore) incRunning() {
+	atomic.AddInt32(&p.running, 1)
+}
+
+func (p *poolCore) decRunning() {
+	atomic.AddInt32(&p.running, -1)
+}
@@ -0,0 +1,100 @@
+package worker_pool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// PoolWithFunc 建立時綁定一個處理函數，之後以 Invoke(args) 提交參數，
+// 不需要像 Pool.Submit 一樣每個任務都配置一個 closure，
+// worker 的生命週期、過期清理以及阻塞的行為與 Pool 相同
+type PoolWithFunc struct {
+	poolCore
+	// poolFunc 處理參數的函數
+	poolFunc func(interface{})
+}
+
+// ---------------------------------------------- 公有函數區 ----------------------------------------------
+
+// Invoke 把參數交給一個 worker 執行 poolFunc
+func (p *PoolWithFunc) Invoke(args interface{}) error {
+	if p.IsClosed() {
+		return ErrPoolClosed
+	}
+	var w *WorkerWithFunc
+	if w = p.retrieveWorker(); w == nil {
+		if p.IsClosed() {
+			return ErrPoolClosed
+		}
+		return ErrPoolOverload
+	}
+	w.args <- args
+	return nil
+}
+
+// Release 關閉這個池子，並釋放工作隊列
+func (p *PoolWithFunc) Release() {
+	if !atomic.CompareAndSwapInt32(&p.status, OPENED, CLOSED) {
+		return
+	}
+	p.closeWorkers()
+}
+
+// ReleaseTimeout 與 Release 相同，並等待所有 worker 結束，超過 timeout 時返回 ErrTimeout
+func (p *PoolWithFunc) ReleaseTimeout(timeout time.Duration) error {
+	if p.IsClosed() {
+		return errors.New("pool is already closed")
+	}
+	p.Release()
+	return p.waitWorkers(timeout)
+}
+
+// Reboot 重新開啟已經關閉的池子
+func (p *PoolWithFunc) Reboot() {
+	if atomic.CompareAndSwapInt32(&p.status, CLOSED, OPENED) {
+		p.startHeartBeat()
+	}
+}
+
+// ---------------------------------------------- 私有函數區 ----------------------------------------------
+
+// retrieveWorker 取得一個可以用的 worker，池子已滿且不阻塞或池子關閉時返回 nil
+func (p *PoolWithFunc) retrieveWorker() *WorkerWithFunc {
+	w := p.poolCore.retrieveWorker(context.Background(), false, p.spawnWorker)
+	if w == nil {
+		return nil
+	}
+	return w.(*WorkerWithFunc)
+}
+
+// spawnWorker 從快取取出並啟動新的 worker
+func (p *PoolWithFunc) spawnWorker() worker {
+	w := p.workerCache.Get().(*WorkerWithFunc)
+	w.run()
+	return w
+}
+
+// ---------------------------------------------- 新建一個 pool ----------------------------------------------
+
+// NewPoolWithFunc 建立綁定 poolFunc 的池子，選項與 NewPool 相同
+func NewPoolWithFunc(size int, poolFunc func(interface{}), options ...Option) (*PoolWithFunc, error) {
+	if poolFunc == nil {
+		return nil, ErrLackPoolFunc
+	}
+	p := &PoolWithFunc{poolFunc: poolFunc}
+	if err := p.init(size, options); err != nil {
+		return nil, err
+	}
+	p.workerCache.New = func() interface{} {
+		return &WorkerWithFunc{
+			pool: p,
+			args: make(chan interface{}, workerChanCap),
+		}
+	}
+
+	p.startHeartBeat()
+
+	return p, nil
+}
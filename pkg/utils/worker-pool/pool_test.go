@@ -1,10 +1,14 @@
 package worker_pool
 
 import (
+	"context"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 const (
 	_   = 1 << (10 * iota)
@@ -63,4 +67,241 @@ func TestPoolWaitToGetWorkerPreMalloc(t *testing.T) {
 	runtime.ReadMemStats(&mem)
 	curMem = mem.TotalAlloc/MiB - curMem
 	t.Logf("memory usage:%d MB", curMem)
-}
\ No newline at end of file
+}
+func TestPoolWithFuncWaitToGetWorker(t *testing.T) {
+	var wg sync.WaitGroup
+	p, _ := NewPoolWithFunc(PoolSize, func(i interface{}) {
+		demoPoolFunc(i)
+		wg.Done()
+	})
+	defer p.Release()
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		_ = p.Invoke(Param)
+	}
+	wg.Wait()
+	t.Logf("pool with func, running workers number:%d", p.Running())
+	mem := runtime.MemStats{}
+	runtime.ReadMemStats(&mem)
+	curMem = mem.TotalAlloc/MiB - curMem
+	t.Logf("memory usage:%d MB", curMem)
+}
+
+func TestPoolWithFunc(t *testing.T) {
+	_, err := NewPoolWithFunc(10, nil)
+	assert.Equal(t, ErrLackPoolFunc, err)
+
+	// nil 參數也會交給 poolFunc
+	var wg sync.WaitGroup
+	var count int32
+	p, err := NewPoolWithFunc(10, func(i interface{}) {
+		if i == nil {
+			atomic.AddInt32(&count, 1)
+		}
+		wg.Done()
+	}, WithExpiryDuration(10*time.Millisecond))
+	assert.Nil(t, err)
+	wg.Add(5)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, p.Invoke(nil))
+	}
+	wg.Wait()
+	assert.Equal(t, int32(5), atomic.LoadInt32(&count))
+	assert.Equal(t, 10, p.Cap())
+
+	// 過期的 worker 會被清除
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, p.Running())
+
+	// NonBlocking 時池子滿了直接返回 ErrPoolOverload
+	block := make(chan struct{})
+	nb, _ := NewPoolWithFunc(1, func(interface{}) { <-block }, WithNonblocking(true))
+	assert.Nil(t, nb.Invoke(1))
+	assert.Equal(t, ErrPoolOverload, nb.Invoke(2))
+	close(block)
+	assert.Nil(t, nb.ReleaseTimeout(time.Second))
+
+	p.Release()
+	assert.Equal(t, ErrPoolClosed, p.Invoke(1))
+	p.Reboot()
+	wg.Add(1)
+	assert.Nil(t, p.Invoke(nil))
+	wg.Wait()
+	p.Release()
+
+	// Release 喚醒阻塞的 Invoke，不會再啟動新的 worker
+	release := make(chan struct{})
+	bp, _ := NewPoolWithFunc(1, func(interface{}) { <-release })
+	assert.Nil(t, bp.Invoke(1))
+	blocked := make(chan error)
+	go func() { blocked <- bp.Invoke(2) }()
+	for {
+		bp.lock.Lock()
+		n := bp.blockingNum
+		bp.lock.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	bp.Release()
+	assert.Equal(t, ErrPoolClosed, <-blocked)
+	assert.Equal(t, 1, bp.Running())
+	close(release)
+	assert.Eventually(t, func() bool { return bp.Running() == 0 }, time.Second, time.Millisecond)
+
+	// Reboot 之後再 Release 會停止新的 purgePeriodically
+	bp.Reboot()
+	heartBeatDone := bp.heartBeatDone
+	bp.Release()
+	select {
+	case <-heartBeatDone:
+	default:
+		t.Fatal("purgePeriodically is still running after Release")
+	}
+}
+
+func TestSubmitContext(t *testing.T) {
+	p, _ := NewPool(1)
+	defer p.Release()
+
+	// 池子滿了，等待 worker 時 ctx 逾時
+	block := make(chan struct{})
+	assert.Nil(t, p.SubmitContext(context.Background(), func(ctx context.Context) { <-block }))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := p.SubmitContext(ctx, func(ctx context.Context) {})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, 0, p.blockingNum)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, p.SubmitContext(canceled, func(ctx context.Context) {}))
+
+	// worker 放回之後可以繼續提交
+	close(block)
+	done := make(chan struct{})
+	assert.Nil(t, p.SubmitContext(context.Background(), func(ctx context.Context) { close(done) }))
+	<-done
+
+	// Release 時取消執行中的任務
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	assert.Nil(t, p.SubmitContext(context.Background(), func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+	}))
+	<-started
+	p.Release()
+	select {
+	case err := <-stopped:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("task is not canceled by Release")
+	}
+	assert.Equal(t, ErrPoolClosed, p.SubmitContext(context.Background(), func(ctx context.Context) {}))
+}
+
+func TestPoolPreAllocExpiry(t *testing.T) {
+	p, _ := NewPool(10, WithPreAlloc(true), WithExpiryDuration(10*time.Millisecond))
+	defer p.Release()
+
+	var wg sync.WaitGroup
+	wg.Add(10)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, p.Submit(func() {
+			time.Sleep(time.Millisecond)
+			wg.Done()
+		}))
+	}
+	wg.Wait()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, p.Running())
+	assert.Equal(t, 0, p.Stats().Idle)
+
+	done := make(chan struct{})
+	assert.Nil(t, p.Submit(func() { close(done) }))
+	<-done
+}
+
+func TestShutdown(t *testing.T) {
+	p, _ := NewPool(1, WithQueues(map[string]QueueConfig{"default": {}}))
+
+	// 執行中、阻塞等待 worker 以及排隊中的任務都會執行完
+	var executed int32
+	block := make(chan struct{})
+	assert.Nil(t, p.Submit(func() {
+		<-block
+		atomic.AddInt32(&executed, 1)
+	}))
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- p.Submit(func() { atomic.AddInt32(&executed, 1) })
+	}()
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, p.Enqueue("default", func() { atomic.AddInt32(&executed, 1) }))
+	}
+	for p.Stats().Blocking < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	type result struct {
+		report ShutdownReport
+		err    error
+	}
+	shutdown := make(chan result, 1)
+	go func() {
+		report, err := p.Shutdown(context.Background())
+		shutdown <- result{report, err}
+	}()
+	for !p.IsDraining() {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, ErrPoolClosed, p.Submit(func() {}))
+	assert.Equal(t, ErrPoolClosed, p.Enqueue("default", func() {}))
+	_, err := p.Shutdown(context.Background())
+	assert.Equal(t, ErrPoolClosed, err)
+
+	close(block)
+	r := <-shutdown
+	assert.Nil(t, r.err)
+	assert.Equal(t, 0, r.report.Abandoned())
+	assert.Nil(t, <-blocked)
+	assert.Equal(t, int32(5), atomic.LoadInt32(&executed))
+	assert.True(t, p.IsClosed())
+
+	// Reboot 之後可以再次使用與 Shutdown
+	p.Reboot()
+	assert.False(t, p.IsClosed())
+	done := make(chan struct{})
+	assert.Nil(t, p.Submit(func() { close(done) }))
+	<-done
+
+	// 逾時時放棄還沒結束的任務，並取消它們的 ctx
+	canceled := make(chan struct{})
+	assert.Nil(t, p.SubmitContext(context.Background(), func(ctx context.Context) {
+		<-ctx.Done()
+		close(canceled)
+	}))
+	assert.Nil(t, p.Enqueue("default", func() {}))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	report, err := p.Shutdown(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	// 排隊的任務可能已經被取出並阻塞等待 worker
+	assert.Equal(t, 1, report.Running)
+	assert.Equal(t, 1, report.Blocked+report.Queued)
+	assert.Equal(t, 2, report.Abandoned())
+	<-canceled
+	assert.True(t, p.IsClosed())
+
+	p.Reboot()
+	done = make(chan struct{})
+	assert.Nil(t, p.Enqueue("default", func() { close(done) }))
+	<-done
+	p.Release()
+}
@@ -0,0 +1,176 @@
+package worker_pool
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"time"
+)
+
+// RetryPolicy 以 SubmitFunc 提交的任務返回錯誤時的重試策略
+type RetryPolicy struct {
+	// MaxAttempts 包含第一次的執行次數，預設 1 表示不重試
+	MaxAttempts int
+	// InitialBackoff 第一次重試前等待的時間，預設 100ms
+	InitialBackoff time.Duration
+	// MaxBackoff 等待時間的上限，預設 10s
+	MaxBackoff time.Duration
+	// Multiplier 每次重試等待時間的倍數，預設 2
+	Multiplier float64
+	// Retryable 判斷錯誤是否需要重試，nil 時除了 PanicError 之外的錯誤都重試
+	Retryable func(err error) bool
+}
+
+// backoff 第 attempt 次執行失敗之後等待的時間
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := policy.InitialBackoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	max := policy.MaxBackoff
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+	multiplier := policy.Multiplier
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff = time.Duration(float64(backoff) * multiplier)
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+func (policy RetryPolicy) retryable(err error) bool {
+	if policy.Retryable != nil {
+		return policy.Retryable(err)
+	}
+	var panicErr *PanicError
+	return !errors.As(err, &panicErr)
+}
+
+// TaskOptions 以 SubmitFunc 提交任務時的選項
+type TaskOptions struct {
+	// Name 任務的名稱，發生 panic 時記錄在 PanicRecord
+	Name string
+	// Retry 重試策略
+	Retry RetryPolicy
+}
+
+// TaskOption ...
+type TaskOption func(opts *TaskOptions)
+
+// WithTaskName ...
+func WithTaskName(name string) TaskOption {
+	return func(opts *TaskOptions) {
+		opts.Name = name
+	}
+}
+
+// WithRetry ...
+func WithRetry(policy RetryPolicy) TaskOption {
+	return func(opts *TaskOptions) {
+		opts.Retry = policy
+	}
+}
+
+// SubmitFunc 提交返回錯誤的任務，失敗時依照 RetryPolicy 在等待之後重新交給 worker，
+// 等待時不會佔用 worker，返回的 Future 在成功、不再重試或被取消時結束，Get 返回最後一次的錯誤，
+// 任務的 panic 與一般任務一樣交給 PanicRecordHandler、PanicHandler 或 dlog，再轉成 PanicError
+func (p *Pool) SubmitFunc(task func(ctx context.Context) error, options ...TaskOption) (*Future, error) {
+	if !p.accepting() {
+		return nil, ErrPoolClosed
+	}
+	opts := TaskOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+	r := &retryTask{
+		pool:    p,
+		future:  newFuture(context.Background()),
+		task:    task,
+		options: opts,
+	}
+	if err := r.submit(context.Background(), p.submit); err != nil {
+		r.future.cancel()
+		return nil, err
+	}
+	return r.future, nil
+}
+
+// retryTask 以 SubmitFunc 提交的任務
+type retryTask struct {
+	pool     *Pool
+	future   *Future
+	task     func(ctx context.Context) error
+	options  TaskOptions
+	attempts int
+}
+
+// submit 以 submit 或 handoff 交給 worker 執行一次，每次執行各自記錄提交的時間
+func (r *retryTask) submit(ctx context.Context, submit func(ctx context.Context, info taskInfo, task func()) error) error {
+	info := taskInfo{name: r.options.Name, fn: r.task, submitted: time.Now(), recovered: new(bool)}
+	return submit(ctx, info, func() { r.run(info) })
+}
+
+// run 在 worker 上執行一次，需要重試時設定計時器重新交給 worker
+func (r *retryTask) run(info taskInfo) {
+	f := r.future
+	select {
+	case <-f.done:
+		return
+	default:
+	}
+	if err := f.ctx.Err(); err != nil {
+		f.complete(nil, err)
+		return
+	}
+	r.attempts++
+	err := r.call(info)
+	if err == nil {
+		f.complete(nil, nil)
+		return
+	}
+	policy := r.options.Retry
+	if r.attempts >= policy.MaxAttempts || !policy.retryable(err) {
+		f.complete(nil, err)
+		return
+	}
+	// 等待重試時仍然計入 inflight，讓 Shutdown 等待重試結束
+	r.pool.addInflight(1)
+	time.AfterFunc(policy.backoff(r.attempts), func() {
+		select {
+		case <-f.done:
+			r.pool.addInflight(-1)
+			return
+		default:
+		}
+		if handoffErr := r.submit(f.ctx, r.pool.handoff); handoffErr != nil {
+			r.pool.addInflight(-1)
+			f.complete(nil, err)
+		}
+	})
+}
+
+// call 執行任務，panic 先交給 handlePanic 再轉成 PanicError
+func (r *retryTask) call(info taskInfo) (err error) {
+	start := time.Now()
+	defer func() {
+		if p := recover(); p != nil {
+			record := &PanicRecord{
+				Value:      p,
+				Stack:      debug.Stack(),
+				Task:       info.taskName(),
+				SubmitTime: info.submitted,
+				StartTime:  start,
+			}
+			*info.recovered = true
+			handlePanic(&r.pool.options, record, r.task)
+			err = &PanicError{Value: record.Value, Stack: record.Stack}
+		}
+	}()
+	return r.task(r.future.ctx)
+}
@@ -0,0 +1,132 @@
+package worker_pool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Multiplier: 3}
+	assert.Equal(t, 10*time.Millisecond, policy.backoff(1))
+	assert.Equal(t, 30*time.Millisecond, policy.backoff(2))
+	assert.Equal(t, 50*time.Millisecond, policy.backoff(3))
+	assert.Equal(t, 100*time.Millisecond, RetryPolicy{}.backoff(1))
+	assert.Equal(t, 10*time.Second, RetryPolicy{}.backoff(100))
+}
+
+func TestSubmitFunc(t *testing.T) {
+	p, _ := NewPool(1)
+	defer p.Release()
+	errTemporary := errors.New("temporary")
+	errPermanent := errors.New("permanent")
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	// 失敗兩次之後成功
+	var attempts int32
+	f, err := p.SubmitFunc(func(ctx context.Context) error {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			return errTemporary
+		}
+		return nil
+	}, WithRetry(policy))
+	assert.Nil(t, err)
+	_, err = f.Get(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+	// 超過次數時返回最後的錯誤
+	atomic.StoreInt32(&attempts, 0)
+	f, _ = p.SubmitFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		return errTemporary
+	}, WithRetry(policy))
+	_, err = f.Get(context.Background())
+	assert.Equal(t, errTemporary, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+	// 不可重試的錯誤
+	atomic.StoreInt32(&attempts, 0)
+	policy.Retryable = func(err error) bool { return !errors.Is(err, errPermanent) }
+	f, _ = p.SubmitFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		return errPermanent
+	}, WithRetry(policy))
+	_, err = f.Get(context.Background())
+	assert.Equal(t, errPermanent, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	// panic 預設不重試
+	atomic.StoreInt32(&attempts, 0)
+	f, _ = p.SubmitFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		panic("boom")
+	}, WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+	_, err = f.Get(context.Background())
+	var panicErr *PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestSubmitFuncPanicRecord(t *testing.T) {
+	records := make(chan *PanicRecord, 2)
+	p, _ := NewPool(1, WithPanicRecordHandler(func(record *PanicRecord) {
+		records <- record
+	}))
+	defer p.Release()
+
+	// 每次 panic 都交給 PanicRecordHandler，之後才結束 Future
+	f, err := p.SubmitFunc(func(ctx context.Context) error {
+		panic("boom")
+	}, WithTaskName("retry-panic"), WithRetry(RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+		Retryable:      func(err error) bool { return true },
+	}))
+	assert.Nil(t, err)
+	_, err = f.Get(context.Background())
+	var panicErr *PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, 2, len(records))
+	for i := 0; i < 2; i++ {
+		record := <-records
+		assert.Equal(t, "boom", record.Value)
+		assert.Equal(t, "retry-panic", record.Task)
+		assert.NotEmpty(t, record.Stack)
+		assert.False(t, record.SubmitTime.IsZero())
+		assert.False(t, record.StartTime.Before(record.SubmitTime))
+	}
+}
+
+func TestSubmitFuncCancel(t *testing.T) {
+	p, _ := NewPool(1)
+	defer p.Release()
+
+	// 等待重試時取消
+	var attempts int32
+	failed := make(chan struct{}, 1)
+	f, err := p.SubmitFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		failed <- struct{}{}
+		return errors.New("temporary")
+	}, WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: 20 * time.Millisecond}))
+	assert.Nil(t, err)
+	<-failed
+	assert.True(t, f.Cancel())
+	_, err = f.Get(context.Background())
+	assert.Equal(t, ErrFutureCanceled, err)
+
+	// Shutdown 等待計時器結束，取消之後不會再執行
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = p.Shutdown(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	_, err = p.SubmitFunc(func(ctx context.Context) error { return nil })
+	assert.Equal(t, ErrPoolClosed, err)
+}
@@ -0,0 +1,398 @@
+package worker_pool
+
+import (
+	"container/heap"
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MissedRunPolicy 週期任務錯過執行時間時的處理方式，
+// 錯過包含排程延遲超過一個間隔，以及到期時上一次執行還沒結束，同一個週期任務不會同時執行
+type MissedRunPolicy int
+
+const (
+	// MissedRunSkip 跳過錯過的執行，等下一個週期（預設）
+	MissedRunSkip MissedRunPolicy = iota
+	// MissedRunOnce 錯過的執行合併成一次，在上一次結束之後立刻補跑
+	MissedRunOnce
+	// MissedRunCatchUp 每一次錯過的執行都在上一次結束之後依序補跑
+	MissedRunCatchUp
+)
+
+// ScheduleOptions 排程任務的選項
+type ScheduleOptions struct {
+	// Jitter 每次執行時間加上 [0, Jitter) 的隨機延遲，避免大量任務同時到期，不影響週期的對齊
+	Jitter time.Duration
+	// MissedRun 週期任務錯過執行時的處理方式
+	MissedRun MissedRunPolicy
+}
+
+// ScheduleOption ...
+type ScheduleOption func(opts *ScheduleOptions)
+
+// WithJitter ...
+func WithJitter(jitter time.Duration) ScheduleOption {
+	return func(opts *ScheduleOptions) {
+		opts.Jitter = jitter
+	}
+}
+
+// WithMissedRun ...
+func WithMissedRun(policy MissedRunPolicy) ScheduleOption {
+	return func(opts *ScheduleOptions) {
+		opts.MissedRun = policy
+	}
+}
+
+// Scheduler 以最小堆積管理延遲與週期任務，到期時交給 Pool 執行，並發數量仍然受到池子容量的限制，
+// 池子沒有空閒的 worker 時，到期的任務各自等待 worker，不會延誤其他排程，
+// 週期任務在等待或執行中再次到期時依照 MissedRunPolicy 處理
+type Scheduler struct {
+	pool *Pool
+	now  func() time.Time
+
+	lock    sync.Mutex
+	entries scheduleHeap
+	seq     uint64
+	stopped bool
+
+	// wake 加入更早的任務時喚醒 run
+	wake     chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once
+	// handoffs 等待 worker 的 dispatch，Stop 時等待它們結束
+	handoffs sync.WaitGroup
+}
+
+// NewScheduler 建立排程器並在背景執行，直到 Stop
+func NewScheduler(pool *Pool) *Scheduler {
+	s := newScheduler(pool)
+	go s.run()
+	return s
+}
+
+func newScheduler(pool *Pool) *Scheduler {
+	s := &Scheduler{
+		pool: pool,
+		now:  time.Now,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// SubmitAfter 在 d 之後執行一次
+func (s *Scheduler) SubmitAfter(d time.Duration, task func(), options ...ScheduleOption) (*ScheduledTask, error) {
+	return s.SubmitAt(s.now().Add(d), task, options...)
+}
+
+// SubmitAt 在 t 執行一次，t 已經過去時立刻執行
+func (s *Scheduler) SubmitAt(t time.Time, task func(), options ...ScheduleOption) (*ScheduledTask, error) {
+	return s.schedule(t, 0, task, options)
+}
+
+// Every 每隔 interval 執行一次，第一次在 interval 之後
+func (s *Scheduler) Every(interval time.Duration, task func(), options ...ScheduleOption) (*ScheduledTask, error) {
+	if interval <= 0 {
+		return nil, ErrInvalidInterval
+	}
+	return s.schedule(s.now().Add(interval), interval, task, options)
+}
+
+// Len 等待中的排程數量
+func (s *Scheduler) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.entries)
+}
+
+// Stop 停止排程器並取消所有等待中的排程，已經交給 worker 的任務不受影響
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		s.lock.Lock()
+		s.stopped = true
+		for _, e := range s.entries {
+			e.index = -1
+			atomic.StoreInt32(&e.state, canceled)
+		}
+		s.entries = nil
+		s.lock.Unlock()
+		s.cancel()
+	})
+	<-s.done
+	s.handoffs.Wait()
+}
+
+func (s *Scheduler) schedule(at time.Time, interval time.Duration, task func(), options []ScheduleOption) (*ScheduledTask, error) {
+	opts := ScheduleOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+	e := &scheduleEntry{task: task, at: at, interval: interval, options: opts, index: -1}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return nil, ErrSchedulerStopped
+	}
+	s.push(e)
+	return &ScheduledTask{scheduler: s, entry: e}, nil
+}
+
+// push 計算下一次的執行時間並放進堆積，呼叫方持有 lock
+func (s *Scheduler) push(e *scheduleEntry) {
+	e.when = e.at
+	if e.options.Jitter > 0 {
+		e.when = e.when.Add(time.Duration(rand.Int63n(int64(e.options.Jitter))))
+	}
+	s.seq++
+	e.seq = s.seq
+	heap.Push(&s.entries, e)
+	if e.index == 0 {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.lock.Lock()
+		var (
+			due  *scheduleEntry
+			wait = time.Duration(-1)
+		)
+		if len(s.entries) > 0 {
+			if wait = s.entries[0].when.Sub(s.now()); wait <= 0 {
+				due = heap.Pop(&s.entries).(*scheduleEntry)
+			}
+		}
+		s.lock.Unlock()
+		if due != nil {
+			s.fire(due)
+			continue
+		}
+
+		var expired <-chan time.Time
+		if wait > 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+			expired = timer.C
+		}
+		select {
+		case <-expired:
+		case <-s.wake:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// fire 處理一個到期的排程，週期任務先排好下一次再交給 worker，讓 Cancel 在執行中也能生效
+func (s *Scheduler) fire(e *scheduleEntry) {
+	if e.interval == 0 {
+		if atomic.CompareAndSwapInt32(&e.state, scheduled, fired) {
+			s.dispatch(e, 1)
+		}
+		return
+	}
+	runs := 1
+	s.lock.Lock()
+	missed := 0
+	// when 包含 jitter，以實際到期的時間計算延遲，jitter 不算錯過
+	if late := s.now().Sub(e.when); late >= e.interval {
+		missed = int(late / e.interval)
+	}
+	e.at = e.at.Add(time.Duration(missed+1) * e.interval)
+	if atomic.LoadInt32(&e.state) == canceled || s.stopped {
+		s.lock.Unlock()
+		return
+	}
+	s.push(e)
+	s.lock.Unlock()
+	if e.options.MissedRun == MissedRunCatchUp {
+		runs += missed
+	} else {
+		atomic.AddUint64(&e.skipped, uint64(missed))
+	}
+	s.dispatch(e, runs)
+}
+
+// dispatch 交給 worker 執行 runs 次，上一次還在等待 worker 或還沒結束時依照 MissedRunPolicy 處理，
+// 同一個排程同時只會有一個等待 worker 的 goroutine，run 不會因為池子已滿而阻塞
+func (s *Scheduler) dispatch(e *scheduleEntry, runs int) {
+	e.lock.Lock()
+	if e.running {
+		switch e.options.MissedRun {
+		case MissedRunOnce:
+			if e.pending == 0 {
+				e.pending, runs = 1, runs-1
+			}
+		case MissedRunCatchUp:
+			e.pending, runs = e.pending+runs, 0
+		}
+		e.lock.Unlock()
+		atomic.AddUint64(&e.skipped, uint64(runs))
+		return
+	}
+	e.running, e.pending = true, runs-1
+	e.lock.Unlock()
+
+	s.handoffs.Add(1)
+	go func() {
+		defer s.handoffs.Done()
+		var err error
+		if !s.pool.accepting() {
+			err = ErrPoolClosed
+		} else {
+			err = s.pool.submit(s.ctx, newTaskInfo(e.task), e.execute)
+		}
+		if err != nil {
+			e.lock.Lock()
+			skipped := 1 + e.pending
+			e.running, e.pending = false, 0
+			e.lock.Unlock()
+			atomic.AddUint64(&e.skipped, uint64(skipped))
+		}
+	}()
+}
+
+// ScheduledTask SubmitAfter、SubmitAt 與 Every 返回的排程
+type ScheduledTask struct {
+	scheduler *Scheduler
+	entry     *scheduleEntry
+}
+
+// Cancel 取消排程，週期任務之後不會再執行，執行中的任務不會被中斷，
+// 已經取消、排程器已經停止或一次性任務已經到期時返回 false
+func (t *ScheduledTask) Cancel() bool {
+	e := t.entry
+	if !atomic.CompareAndSwapInt32(&e.state, scheduled, canceled) {
+		return false
+	}
+	s := t.scheduler
+	s.lock.Lock()
+	if e.index >= 0 {
+		heap.Remove(&s.entries, e.index)
+	}
+	s.lock.Unlock()
+	return true
+}
+
+// Next 下一次預計執行的時間，不包含 jitter
+func (t *ScheduledTask) Next() time.Time {
+	t.scheduler.lock.Lock()
+	defer t.scheduler.lock.Unlock()
+	return t.entry.at
+}
+
+// Runs 已經執行完成的次數
+func (t *ScheduledTask) Runs() uint64 {
+	return atomic.LoadUint64(&t.entry.runs)
+}
+
+// Skipped 因為錯過、池子已滿、關閉或排程器停止而沒有執行的次數
+func (t *ScheduledTask) Skipped() uint64 {
+	return atomic.LoadUint64(&t.entry.skipped)
+}
+
+// scheduleEntry 的狀態，週期任務執行之後仍然是 scheduled
+const (
+	scheduled int32 = iota
+	canceled
+	fired
+)
+
+// scheduleEntry 堆積中的一個排程
+type scheduleEntry struct {
+	runs    uint64
+	skipped uint64
+	state   int32
+
+	task     func()
+	options  ScheduleOptions
+	interval time.Duration
+	// at 對齊週期的預計執行時間，when 為加上 jitter 之後實際到期的時間，受到 Scheduler.lock 保護
+	at    time.Time
+	when  time.Time
+	seq   uint64
+	index int
+
+	// lock 保護 running 與 pending，pending 為上一次結束之後要補跑的次數
+	lock    sync.Mutex
+	running bool
+	pending int
+}
+
+// execute 在 worker 上執行，結束之後依序補跑 pending，panic 時放棄剩下的補跑
+func (e *scheduleEntry) execute() {
+	completed := false
+	defer func() {
+		if !completed {
+			e.lock.Lock()
+			e.running, e.pending = false, 0
+			e.lock.Unlock()
+		}
+	}()
+	for {
+		e.task()
+		atomic.AddUint64(&e.runs, 1)
+		e.lock.Lock()
+		if e.pending == 0 || atomic.LoadInt32(&e.state) == canceled {
+			e.running, e.pending = false, 0
+			e.lock.Unlock()
+			completed = true
+			return
+		}
+		e.pending--
+		e.lock.Unlock()
+	}
+}
+
+// scheduleHeap 以 when 排序的最小堆積，時間相同時先加入的先執行
+type scheduleHeap []*scheduleEntry
+
+func (h scheduleHeap) Len() int { return len(h) }
+
+func (h scheduleHeap) Less(i, j int) bool {
+	if h[i].when.Equal(h[j].when) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].when.Before(h[j].when)
+}
+
+func (h scheduleHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *scheduleHeap) Push(x interface{}) {
+	e := x.(*scheduleEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *scheduleHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
@@ -0,0 +1,171 @@
+package worker_pool
+
+import (
+	"container/heap"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler(t *testing.T) {
+	p, _ := NewPool(2)
+	defer p.Release()
+	s := NewScheduler(p)
+	defer s.Stop()
+
+	// 延遲執行
+	done := make(chan time.Time, 1)
+	start := time.Now()
+	task, err := s.SubmitAfter(20*time.Millisecond, func() { done <- time.Now() })
+	assert.Nil(t, err)
+	assert.True(t, (<-done).Sub(start) >= 20*time.Millisecond)
+	assert.False(t, task.Cancel())
+
+	// 過去的時間立刻執行
+	_, err = s.SubmitAt(time.Now().Add(-time.Second), func() { done <- time.Now() })
+	assert.Nil(t, err)
+	<-done
+
+	// 到期前取消
+	var canceled int32
+	task, _ = s.SubmitAfter(20*time.Millisecond, func() { atomic.StoreInt32(&canceled, 1) })
+	assert.Equal(t, 1, s.Len())
+	assert.True(t, task.Cancel())
+	assert.False(t, task.Cancel())
+	assert.Equal(t, 0, s.Len())
+
+	// 週期執行
+	task, err = s.Every(5*time.Millisecond, func() {}, WithJitter(time.Millisecond))
+	assert.Nil(t, err)
+	next := task.Next()
+	assert.Eventually(t, func() bool { return task.Runs() >= 3 }, time.Second, time.Millisecond)
+	assert.True(t, task.Next().After(next))
+	assert.True(t, task.Cancel())
+	runs := task.Runs()
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, task.Runs() <= runs+1)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&canceled))
+
+	_, err = s.Every(0, func() {})
+	assert.Equal(t, ErrInvalidInterval, err)
+
+	task, _ = s.Every(time.Hour, func() {})
+	s.Stop()
+	assert.Equal(t, 0, s.Len())
+	assert.False(t, task.Cancel())
+	_, err = s.SubmitAfter(time.Millisecond, func() {})
+	assert.Equal(t, ErrSchedulerStopped, err)
+}
+
+func TestSchedulerMissedRun(t *testing.T) {
+	p, _ := NewPool(4)
+	defer p.Release()
+	s := newScheduler(p)
+	base := time.Now()
+	now := base
+	s.now = func() time.Time { return now }
+
+	// every 以假的時間直接觸發，gate 關閉之前第一次執行會一直阻塞
+	every := func(policy MissedRunPolicy, gate chan struct{}) *ScheduledTask {
+		task, _ := s.Every(time.Second, func() { <-gate }, WithMissedRun(policy))
+		return task
+	}
+	fire := func(task *ScheduledTask, late time.Duration) {
+		now = task.entry.at.Add(late)
+		s.lock.Lock()
+		if task.entry.index >= 0 {
+			heap.Remove(&s.entries, task.entry.index)
+		}
+		s.lock.Unlock()
+		s.fire(task.entry)
+	}
+	running := func(task *ScheduledTask) bool {
+		task.entry.lock.Lock()
+		defer task.entry.lock.Unlock()
+		return task.entry.running
+	}
+
+	// 跳過延遲的三次，以及執行中到期的一次
+	gate := make(chan struct{})
+	task := every(MissedRunSkip, gate)
+	fire(task, 3500*time.Millisecond)
+	assert.Equal(t, base.Add(5*time.Second), task.Next())
+	assert.Eventually(t, func() bool { return running(task) }, time.Second, time.Millisecond)
+	fire(task, 0)
+	close(gate)
+	assert.Eventually(t, func() bool { return !running(task) }, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(1), task.Runs())
+	assert.Equal(t, uint64(4), task.Skipped())
+
+	// 合併成一次補跑
+	gate = make(chan struct{})
+	task = every(MissedRunOnce, gate)
+	fire(task, 2500*time.Millisecond)
+	fire(task, 0)
+	fire(task, 0)
+	close(gate)
+	assert.Eventually(t, func() bool { return task.Runs() == 2 && !running(task) }, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(3), task.Skipped())
+
+	// 每一次都補跑
+	gate = make(chan struct{})
+	task = every(MissedRunCatchUp, gate)
+	next := task.Next()
+	fire(task, 2500*time.Millisecond)
+	fire(task, 0)
+	close(gate)
+	assert.Eventually(t, func() bool { return task.Runs() == 4 && !running(task) }, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(0), task.Skipped())
+	assert.Equal(t, next.Add(4*time.Second), task.Next())
+
+	// jitter 造成的延遲不算錯過，即使 jitter 超過間隔
+	task, _ = s.Every(time.Second, func() {}, WithJitter(3*time.Second))
+	next = task.Next()
+	s.lock.Lock()
+	heap.Remove(&s.entries, task.entry.index)
+	now = task.entry.when
+	s.lock.Unlock()
+	s.fire(task.entry)
+	assert.Eventually(t, func() bool { return task.Runs() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(0), task.Skipped())
+	assert.Equal(t, next.Add(time.Second), task.Next())
+
+	// 池子關閉之後跳過
+	p.Release()
+	fire(task, 0)
+	assert.Eventually(t, func() bool { return task.Skipped() == 1 }, time.Second, time.Millisecond)
+}
+
+func TestSchedulerFullPool(t *testing.T) {
+	p, _ := NewPool(1)
+	defer p.Release()
+	s := NewScheduler(p)
+	defer s.Stop()
+
+	// 池子已滿，到期的任務等待 worker 時，其他排程仍然準時到期
+	release := make(chan struct{})
+	assert.Nil(t, p.Submit(func() { <-release }))
+	var runs int32
+	waiting, _ := s.SubmitAfter(0, func() { atomic.AddInt32(&runs, 1) })
+	start := time.Now()
+	later, _ := s.SubmitAfter(20*time.Millisecond, func() { atomic.AddInt32(&runs, 1) })
+	assert.Eventually(t, func() bool { return s.Len() == 0 }, time.Second, time.Millisecond)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+	assert.False(t, waiting.Cancel())
+	assert.False(t, later.Cancel())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&runs))
+	close(release)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) == 2 }, time.Second, time.Millisecond)
+
+	// Stop 會結束還在等待 worker 的排程
+	block := make(chan struct{})
+	defer close(block)
+	assert.Nil(t, p.Submit(func() { <-block }))
+	stuck, _ := s.SubmitAfter(0, func() {})
+	assert.Eventually(t, func() bool { return s.Len() == 0 }, time.Second, time.Millisecond)
+	s.Stop()
+	assert.Equal(t, uint64(1), stuck.Skipped())
+	assert.Equal(t, uint64(0), stuck.Runs())
+}
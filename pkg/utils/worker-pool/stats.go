@@ -0,0 +1,151 @@
+package worker_pool
+
+import (
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// statsBuckets 等待時間與執行時間的直方圖上界，單位為秒
+var statsBuckets = [...]float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// Stats 池子在某一個時間點的統計
+type Stats struct {
+	// Capacity 池子的容量，-1 表示不限制
+	Capacity int
+	// Running 正在執行中的 worker 數量
+	Running int
+	// Idle 閒置在池子中等待任務的 worker 數量
+	Idle int
+	// Blocking 正在 Submit 阻塞等待 worker 的數量
+	Blocking int
+	// Queued 排隊模式中排隊的任務數量
+	Queued int
+	// Submitted 已經交給 worker 的任務數量
+	Submitted uint64
+	// Completed 正常結束的任務數量
+	Completed uint64
+	// Rejected 因為池子關閉、已滿、ctx 結束或隊列已滿而被拒絕的任務數量
+	Rejected uint64
+	// Panicked 發生 panic 的任務數量
+	Panicked uint64
+	// WaitTime 從提交到開始執行的時間，排隊模式包含排隊的時間
+	WaitTime Histogram
+	// ExecTime 任務執行的時間
+	ExecTime Histogram
+}
+
+// Histogram 直方圖的快照
+type Histogram struct {
+	// Count 觀測的次數
+	Count uint64
+	// Sum 觀測值的總和
+	Sum time.Duration
+	// Buckets 由 0.5ms 到 10s 的上界（秒）以及小於等於該上界的累計次數
+	Buckets []HistogramBucket
+}
+
+// HistogramBucket 直方圖的一個區間
+type HistogramBucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+// Stats 返回目前的統計
+func (p *Pool) Stats() Stats {
+	p.lock.Lock()
+	idle, blocking := p.workers.len(), p.blockingNum
+	p.lock.Unlock()
+	stats := Stats{
+		Capacity:  p.Cap(),
+		Running:   p.Running(),
+		Idle:      idle,
+		Blocking:  blocking,
+		Submitted: atomic.LoadUint64(&p.stats.submitted),
+		Completed: atomic.LoadUint64(&p.stats.completed),
+		Rejected:  atomic.LoadUint64(&p.stats.rejected),
+		Panicked:  atomic.LoadUint64(&p.stats.panicked),
+		WaitTime:  p.stats.wait.snapshot(),
+		ExecTime:  p.stats.exec.snapshot(),
+	}
+	if p.queue != nil {
+		stats.Queued = p.queue.size()
+	}
+	return stats
+}
+
+// poolStats 以原子操作累計的計數
+type poolStats struct {
+	submitted uint64
+	completed uint64
+	rejected  uint64
+	panicked  uint64
+	wait      histogram
+	exec      histogram
+}
+
+// wrap 包裝任務以統計等待時間、執行時間以及結束的方式，
+// panic 會轉成 PanicRecord 之後再交給 worker 處理，任務自行 recover 的 panic 以 info.recovered 計入 Panicked
+func (p *Pool) wrap(task func(), info taskInfo) func() {
+	s := &p.stats
+	return func() {
+		start := time.Now()
+		s.wait.observe(start.Sub(info.submitted))
+		completed := false
+		defer func() {
+			s.exec.observe(time.Since(start))
+			p.addInflight(-1)
+			if completed {
+				atomic.AddUint64(&s.completed, 1)
+				return
+			}
+			atomic.AddUint64(&s.panicked, 1)
+			if r := recover(); r != nil {
+				panic(&PanicRecord{
+					Value:      r,
+					Stack:      debug.Stack(),
+					Task:       info.taskName(),
+					SubmitTime: info.submitted,
+					StartTime:  start,
+				})
+			}
+		}()
+		task()
+		completed = info.recovered == nil || !*info.recovered
+	}
+}
+
+// histogram 固定使用 statsBuckets 的直方圖，最後一格為超過最大上界的次數
+type histogram struct {
+	counts [len(statsBuckets) + 1]uint64
+	count  uint64
+	sum    int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	index := len(statsBuckets)
+	for i, bound := range statsBuckets {
+		if seconds <= bound {
+			index = i
+			break
+		}
+	}
+	atomic.AddUint64(&h.counts[index], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+	atomic.AddUint64(&h.count, 1)
+}
+
+func (h *histogram) snapshot() Histogram {
+	snapshot := Histogram{
+		Count:   atomic.LoadUint64(&h.count),
+		Sum:     time.Duration(atomic.LoadInt64(&h.sum)),
+		Buckets: make([]HistogramBucket, len(statsBuckets)),
+	}
+	var cumulative uint64
+	for i, bound := range statsBuckets {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		snapshot.Buckets[i] = HistogramBucket{UpperBound: bound, Count: cumulative}
+	}
+	return snapshot
+}
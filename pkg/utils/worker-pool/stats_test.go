@@ -0,0 +1,94 @@
+package worker_pool
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	var panics sync.WaitGroup
+	p, _ := NewPool(2, WithNonblocking(true), WithPanicHandler(func(interface{}) { panics.Done() }))
+	defer p.Release()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	block := make(chan struct{})
+	assert.Nil(t, p.Submit(func() { <-block; wg.Done() }))
+	panics.Add(1)
+	assert.Nil(t, p.Submit(func() { panic("boom") }))
+	panics.Wait()
+
+	stats := p.Stats()
+	assert.Equal(t, 2, stats.Capacity)
+	assert.Equal(t, uint64(2), stats.Submitted)
+	assert.Equal(t, uint64(1), stats.Panicked)
+
+	// 池子滿了被拒絕
+	for p.Running() < 2 {
+		wg.Add(1)
+		_ = p.Submit(func() { <-block; wg.Done() })
+	}
+	assert.Equal(t, ErrPoolOverload, p.Submit(func() {}))
+	close(block)
+	wg.Wait()
+
+	// SubmitFunc 的 panic 與一般任務一樣計入 Panicked
+	panics.Add(1)
+	f, err := p.SubmitFunc(func(ctx context.Context) error { panic("boom") })
+	assert.Nil(t, err)
+	_, err = f.Get(context.Background())
+	assert.NotNil(t, err)
+	panics.Wait()
+	for p.Stats().Panicked < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	stats = p.Stats()
+	assert.True(t, stats.Rejected >= 1)
+	assert.Equal(t, uint64(2), stats.Panicked)
+	assert.Equal(t, stats.Submitted, stats.Completed+stats.Panicked)
+	assert.Equal(t, stats.Submitted, stats.WaitTime.Count)
+	assert.Equal(t, stats.Submitted, stats.ExecTime.Count)
+	assert.Equal(t, stats.ExecTime.Count, stats.ExecTime.Buckets[len(stats.ExecTime.Buckets)-1].Count)
+	assert.Equal(t, 0, stats.Blocking)
+
+	collector := NewCollector("test", p)
+	registry := prometheus.NewPedanticRegistry()
+	assert.Nil(t, registry.Register(collector))
+	assert.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP worker_pool_capacity Capacity of the pool, -1 means unlimited.
+# TYPE worker_pool_capacity gauge
+worker_pool_capacity{pool="test"} 2
+# HELP worker_pool_panicked_tasks_total Total number of tasks that panicked.
+# TYPE worker_pool_panicked_tasks_total counter
+worker_pool_panicked_tasks_total{pool="test"} 2
+`), "worker_pool_capacity", "worker_pool_panicked_tasks_total"))
+	count, err := testutil.GatherAndCount(registry)
+	assert.Nil(t, err)
+	assert.Equal(t, 11, count)
+}
+
+func TestStatsQueueWait(t *testing.T) {
+	p, _ := NewPool(1, WithQueues(map[string]QueueConfig{"default": {}}))
+	defer p.Release()
+
+	block := make(chan struct{})
+	assert.Nil(t, p.Submit(func() { <-block }))
+	done := make(chan struct{})
+	assert.Nil(t, p.Enqueue("default", func() { close(done) }))
+	time.Sleep(20 * time.Millisecond)
+	close(block)
+	<-done
+	time.Sleep(10 * time.Millisecond)
+
+	stats := p.Stats()
+	assert.Equal(t, uint64(2), stats.Submitted)
+	assert.True(t, stats.WaitTime.Sum >= 20*time.Millisecond, stats.WaitTime.Sum)
+}
@@ -1,7 +1,6 @@
 package worker_pool
 
 import (
-	"log"
 	"time"
 )
 
@@ -29,14 +28,9 @@ func(w *Worker)run(){
 			// 把worker 放入快取持，一段時間後再返回原本的
 			// 如果有事都會先去快取池，取資料速度較快
 			w.pool.workerCache.Put(w)
-			// 如果有壞掉的話
+			// 如果有壞掉的話，交給登記的 handler，沒有就以 dlog 記錄
 			if p:= recover(); p != nil{
-				// 如果有登記錯誤控制的 handler 給他用專屬的，沒有就直接印出來
-				if ph := w.pool.options.PanicHandler; ph != nil{
-					ph(p)
-				} else {
-					log.Printf("worker exits from a panic: %v\n", p)
-				}
+				handlePanic(&w.pool.options, p, nil)
 			}
 			// 隨機從阻塞的隊列當中喚醒一個
 			w.pool.cond.Signal()
@@ -48,6 +42,7 @@ func(w *Worker)run(){
 				return
 			}
 			f()
+			w.recycleTime = time.Now()
 			// 執行完任務，主動把自己放回池子中，如果沒有放回去，就走 defer 放回去的流程
 			if ok := w.pool.revertWorker(w); !ok{
 				return
@@ -55,6 +50,16 @@ func(w *Worker)run(){
 		}
 	}()
 }
+// finish 通知 worker 結束
+func (w *Worker) finish() {
+	w.task <- nil
+}
+
+// lastUsedTime ...
+func (w *Worker) lastUsedTime() time.Time {
+	return w.recycleTime
+}
+
 // -------------------
 
 type QueueType int
@@ -64,17 +69,25 @@ const (
 	loopQueueType
 )
 
+// worker Pool 與 PoolWithFunc 的 worker 共用的行為，讓兩種池子可以使用同一個 workerQueue
+type worker interface {
+	// finish 通知 worker 結束
+	finish()
+	// lastUsedTime 最後一次放回池子的時間
+	lastUsedTime() time.Time
+}
+
 type workerQueue interface {
 	// len worker 長度
 	len() int
 	// isEmpty worker 是不是空的
 	isEmpty() bool
 	// insert 放回 queue當中
-	insert(worker *Worker) error
+	insert(worker worker) error
 	// detach 從 queue 當中取出一個worker
-	detach() *Worker
+	detach() worker
 	// retrieveExpiry 檢查到期的 worker
-	retrieveExpiry(d time.Duration)[]*Worker
+	retrieveExpiry(d time.Duration)[]worker
 	reset()
 }
 
@@ -82,8 +95,8 @@ func newWorkerQueue(qType QueueType, size int)workerQueue{
 	switch qType {
 	case stackType:
 		return newWorkerStack(size)
-	//case loopQueueType:
-	//	return newWorkerLoopQueue(size)
+	case loopQueueType:
+		return newWorkerLoopQueue(size)
 	default:
 		return newWorkerStack(size)
 	}
@@ -0,0 +1,53 @@
+package worker_pool
+
+import (
+	"time"
+)
+
+// stopSignal 通知 WorkerWithFunc 結束，讓 Invoke 可以傳入 nil
+type stopSignal struct{}
+
+// WorkerWithFunc PoolWithFunc 的 worker，從 args 接收參數交給 poolFunc
+type WorkerWithFunc struct {
+	// pool 這個 worker 所屬的池子
+	pool *PoolWithFunc
+	// args 欲處理的參數
+	args chan interface{}
+	// recycleTime 將 worker 放回池子的時間，用來判斷是否過期
+	recycleTime time.Time
+}
+
+// run 與 Worker.run 相同，收到 stopSignal 時結束
+func (w *WorkerWithFunc) run() {
+	w.pool.incRunning()
+	go func() {
+		defer func() {
+			w.pool.decRunning()
+			w.pool.workerCache.Put(w)
+			if p := recover(); p != nil {
+				handlePanic(&w.pool.options, p, w.pool.poolFunc)
+			}
+			w.pool.cond.Signal()
+		}()
+		for args := range w.args {
+			if _, ok := args.(stopSignal); ok {
+				return
+			}
+			w.pool.poolFunc(args)
+			w.recycleTime = time.Now()
+			if ok := w.pool.revertWorker(w); !ok {
+				return
+			}
+		}
+	}()
+}
+
+// finish 通知 worker 結束
+func (w *WorkerWithFunc) finish() {
+	w.args <- stopSignal{}
+}
+
+// lastUsedTime ...
+func (w *WorkerWithFunc) lastUsedTime() time.Time {
+	return w.recycleTime
+}
@@ -0,0 +1,118 @@
+package worker_pool
+
+import "time"
+
+// loopQueue 固定大小的環狀隊列，PreAlloc 模式使用，建立之後不會再配置記憶體，
+// worker 從 tail 放入、從 head 取出，所以 head 到 tail 依照放回的時間排序
+type loopQueue struct {
+	items  []worker
+	expiry []worker
+	head   int
+	tail   int
+	size   int
+	isFull bool
+}
+
+func newWorkerLoopQueue(size int) *loopQueue {
+	return &loopQueue{
+		items: make([]worker, size),
+		size:  size,
+	}
+}
+
+// len worker 長度
+func (q *loopQueue) len() int {
+	if q.size == 0 {
+		return 0
+	}
+	if q.head == q.tail {
+		if q.isFull {
+			return q.size
+		}
+		return 0
+	}
+	if q.tail > q.head {
+		return q.tail - q.head
+	}
+	return q.size - q.head + q.tail
+}
+
+// isEmpty worker 是不是空的
+func (q *loopQueue) isEmpty() bool {
+	return q.head == q.tail && !q.isFull
+}
+
+// insert 放到 tail，滿了返回 errQueueIsFull
+func (q *loopQueue) insert(worker worker) error {
+	if q.size == 0 {
+		return errQueueIsReleased
+	}
+	if q.isFull {
+		return errQueueIsFull
+	}
+	q.items[q.tail] = worker
+	q.tail = (q.tail + 1) % q.size
+	if q.tail == q.head {
+		q.isFull = true
+	}
+	return nil
+}
+
+// detach 從 head 取出最早放回的 worker
+func (q *loopQueue) detach() worker {
+	if q.isEmpty() {
+		return nil
+	}
+	w := q.items[q.head]
+	q.items[q.head] = nil
+	q.head = (q.head + 1) % q.size
+	q.isFull = false
+	return w
+}
+
+// retrieveExpiry 從 head 開始取出所有過期的 worker
+func (q *loopQueue) retrieveExpiry(d time.Duration) []worker {
+	q.expiry = q.expiry[:0]
+	if q.isEmpty() {
+		return nil
+	}
+	expiryTime := time.Now().Add(-d)
+	index := q.binarySearch(expiryTime)
+	if index == -1 {
+		return nil
+	}
+	for i := 0; i <= index; i++ {
+		q.expiry = append(q.expiry, q.items[q.head])
+		q.items[q.head] = nil
+		q.head = (q.head + 1) % q.size
+	}
+	q.isFull = false
+	return q.expiry
+}
+
+// binarySearch 以相對 head 的位置搜尋最後一個在 expiryTime 之前（含）放回的 worker，都沒有過期時返回 -1
+func (q *loopQueue) binarySearch(expiryTime time.Time) int {
+	leftPointer, rightPointer := 0, q.len()-1
+	for leftPointer <= rightPointer {
+		mid := leftPointer + (rightPointer-leftPointer)/2
+		if expiryTime.Before(q.items[(q.head+mid)%q.size].lastUsedTime()) {
+			rightPointer = mid - 1
+		} else {
+			leftPointer = mid + 1
+		}
+	}
+	return rightPointer
+}
+
+// reset 通知所有 worker 結束並清空隊列
+func (q *loopQueue) reset() {
+	for {
+		w := q.detach()
+		if w == nil {
+			break
+		}
+		w.finish()
+	}
+	q.head, q.tail = 0, 0
+	q.isFull = false
+}
@@ -0,0 +1,117 @@
+package worker_pool
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeWorker 測試用的 worker，只記錄放回的時間與是否被通知結束
+type fakeWorker struct {
+	id       int
+	used     time.Time
+	finished bool
+}
+
+func (w *fakeWorker) finish() {
+	w.finished = true
+}
+
+func (w *fakeWorker) lastUsedTime() time.Time {
+	return w.used
+}
+
+// TestWorkerQueueProperties 隨機操作兩種隊列，並與簡單的模型比較
+func TestWorkerQueueProperties(t *testing.T) {
+	const size = 16
+	for _, qType := range []QueueType{stackType, loopQueueType} {
+		rnd := rand.New(rand.NewSource(int64(qType)))
+		for round := 0; round < 200; round++ {
+			q := newWorkerQueue(qType, size)
+			model := make([]*fakeWorker, 0, size)
+			now := time.Now().Add(-time.Hour)
+			next := 0
+			for op := 0; op < 100; op++ {
+				switch rnd.Intn(3) {
+				case 0:
+					// 放回時間遞增，與池子的行為相同
+					now = now.Add(time.Duration(rnd.Intn(3)) * time.Second)
+					w := &fakeWorker{id: next, used: now}
+					next++
+					err := q.insert(w)
+					if qType == loopQueueType && len(model) == size {
+						assert.Equal(t, errQueueIsFull, err)
+						continue
+					}
+					assert.Nil(t, err)
+					model = append(model, w)
+				case 1:
+					w := q.detach()
+					if len(model) == 0 {
+						assert.Nil(t, w)
+						continue
+					}
+					// stack 取出最後放回的，loop queue 取出最早放回的
+					var expected *fakeWorker
+					if qType == stackType {
+						expected, model = model[len(model)-1], model[:len(model)-1]
+					} else {
+						expected, model = model[0], model[1:]
+					}
+					assert.Equal(t, expected, w)
+				case 2:
+					// 以目前的時間為基準，隨機的過期時間
+					d := time.Duration(rnd.Intn(int(time.Since(now)/time.Second)+20)) * time.Second
+					expiryTime := time.Now().Add(-d)
+					expired := make([]worker, 0)
+					for len(model) > 0 && !expiryTime.Before(model[0].used) {
+						expired = append(expired, model[0])
+						model = model[1:]
+					}
+					got := q.retrieveExpiry(d)
+					assert.Equal(t, len(expired), len(got))
+					for i := range got {
+						if i < len(expired) {
+							assert.Equal(t, expired[i], got[i])
+						}
+					}
+				}
+				assert.Equal(t, len(model), q.len())
+				assert.Equal(t, len(model) == 0, q.isEmpty())
+			}
+
+			q.reset()
+			assert.Equal(t, 0, q.len())
+			for _, w := range model {
+				assert.True(t, w.finished)
+			}
+		}
+	}
+}
+
+func TestWorkerQueueBinarySearch(t *testing.T) {
+	now := time.Now()
+	stack := newWorkerStack(0)
+	loop := newWorkerLoopQueue(4)
+	// 讓 loop queue 的 head 繞過陣列的尾端
+	for i := 0; i < 3; i++ {
+		_ = loop.insert(&fakeWorker{used: now})
+		loop.detach()
+	}
+	for i := 0; i < 4; i++ {
+		w := &fakeWorker{id: i, used: now.Add(time.Duration(i) * time.Second)}
+		_ = stack.insert(w)
+		assert.Nil(t, loop.insert(w))
+	}
+	for i := -1; i < 5; i++ {
+		expiryTime := now.Add(time.Duration(i) * time.Second)
+		expected := i
+		if expected > 3 {
+			expected = 3
+		}
+		assert.Equal(t, expected, stack.binarySearch(0, stack.len()-1, expiryTime))
+		assert.Equal(t, expected, loop.binarySearch(expiryTime))
+	}
+}
@@ -3,8 +3,8 @@ package worker_pool
 import "time"
 
 type workerStack struct {
-	workers []*Worker
-	expiry 	[]*Worker
+	workers []worker
+	expiry 	[]worker
 	size 	int
 }
 
@@ -19,13 +19,13 @@ func(w *workerStack) isEmpty()bool{
 }
 
 // insert(worker *Worker) error
-func(w *workerStack) insert(worker *Worker) error{
+func(w *workerStack) insert(worker worker) error{
 	w.workers = append(w.workers, worker)
 	return nil
 }
 
 //detach 從 queue 當中取出一個worker
-func(w *workerStack) detach() *Worker{
+func(w *workerStack) detach() worker{
 	// 如果不為零，就從最後面拿出一個，如果為零，就說拿不到
 	workerCount := w.len()
 	if workerCount ==0{
@@ -39,7 +39,7 @@ func(w *workerStack) detach() *Worker{
 }
 
 // retrieveExpiry 把過期的 worker 都清除，並返回沒有過期的
-func(w *workerStack) retrieveExpiry(d time.Duration)[]*Worker{
+func(w *workerStack) retrieveExpiry(d time.Duration)[]worker{
 	// 取得目前有多少 worker，如果為零，就不用清理了
 	workerCount := w.len()
 	if workerCount ==0{
@@ -63,15 +63,15 @@ func(w *workerStack) retrieveExpiry(d time.Duration)[]*Worker{
 	return w.expiry
 }
 
-// binarySearch 找尋這個過期時間
+// binarySearch 找出最後一個在 expiryTime 之前（含）放回的 worker，都沒有過期時返回 -1
 func(w *workerStack) binarySearch(leftPointer, rightPointer int, expiryTime time.Time) int {
 	var mid int
 	for leftPointer <= rightPointer{
-		mid = (leftPointer + rightPointer) /2
-		if expiryTime.Before(w.workers[mid].recycleTime){
-			rightPointer-=mid
+		mid = leftPointer + (rightPointer-leftPointer)/2
+		if expiryTime.Before(w.workers[mid].lastUsedTime()){
+			rightPointer = mid - 1
 		} else{
-			leftPointer+=mid
+			leftPointer = mid + 1
 		}
 	}
 	return rightPointer
@@ -79,7 +79,7 @@ func(w *workerStack) binarySearch(leftPointer, rightPointer int, expiryTime time
 
 func(w *workerStack) reset()  {
 	for item := 0; item <w.len(); item++{
-		w.workers[item].task <- nil
+		w.workers[item].finish()
 		w.workers[item] = nil
 	}
 	w.workers = w.workers[:0]
@@ -87,7 +87,7 @@ func(w *workerStack) reset()  {
 
 func newWorkerStack(size int) *workerStack {
 	return &workerStack{
-		workers: make([]*Worker, 0, size),
+		workers: make([]worker, 0, size),
 		size:  size,
 	}
 }
\ No newline at end of file